@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// outputRecorder records the lines written to several streams in the order
+// they arrive
+type outputRecorder struct {
+	mu      sync.Mutex
+	lines   []handlers.OutputLine
+	pending map[string]*pendingLine
+}
+
+// pendingLine is a line that has been started but not yet terminated
+type pendingLine struct {
+	buf   bytes.Buffer
+	start time.Time
+}
+
+// newOutputRecorder creates an empty outputRecorder
+func newOutputRecorder() *outputRecorder {
+	return &outputRecorder{
+		pending: make(map[string]*pendingLine),
+	}
+}
+
+// Writer returns a writer that records everything written to it as lines of
+// the named stream
+func (r *outputRecorder) Writer(stream string) io.Writer {
+	return &streamWriter{recorder: r, stream: stream}
+}
+
+// write splits p into lines and records every completed one
+func (r *outputRecorder) write(stream string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for len(p) > 0 {
+		pl, ok := r.pending[stream]
+		if !ok {
+			pl = &pendingLine{start: now}
+			r.pending[stream] = pl
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			pl.buf.Write(p)
+			return
+		}
+		pl.buf.Write(p[:i])
+		r.emit(stream, pl)
+		p = p[i+1:]
+	}
+}
+
+// emit appends a pending line to the recorded lines. The caller must hold mu.
+func (r *outputRecorder) emit(stream string, pl *pendingLine) {
+	r.lines = append(r.lines, handlers.OutputLine{
+		Stream: stream,
+		Time:   pl.start,
+		Text:   pl.buf.String(),
+	})
+	delete(r.pending, stream)
+}
+
+// Lines flushes any unterminated lines and returns all recorded lines in
+// arrival order
+func (r *outputRecorder) Lines() []handlers.OutputLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Flush in the order the unterminated lines were started
+	for len(r.pending) > 0 {
+		var first string
+		for stream, pl := range r.pending {
+			if first == "" || pl.start.Before(r.pending[first].start) ||
+				(pl.start.Equal(r.pending[first].start) && stream < first) {
+				first = stream
+			}
+		}
+		r.emit(first, r.pending[first])
+	}
+
+	return r.lines
+}
+
+// streamWriter is an io.Writer feeding one stream of an outputRecorder
+type streamWriter struct {
+	recorder *outputRecorder
+	stream   string
+}
+
+// Write implements io.Writer
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.recorder.write(w.stream, p)
+	return len(p), nil
+}
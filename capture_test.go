@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+func TestOutputRecorder(t *testing.T) {
+	recorder := newOutputRecorder()
+	stdout := recorder.Writer(handlers.StreamStdout)
+	stderr := recorder.Writer(handlers.StreamStderr)
+
+	// Lines split across writes are joined, and each stream keeps its own
+	// partial line
+	io.WriteString(stdout, "first ")
+	io.WriteString(stderr, "warning\n")
+	io.WriteString(stdout, "line\nsecond line\n")
+	io.WriteString(stderr, "no newline")
+
+	lines := recorder.Lines()
+
+	want := []handlers.OutputLine{
+		{Stream: handlers.StreamStderr, Text: "warning"},
+		{Stream: handlers.StreamStdout, Text: "first line"},
+		{Stream: handlers.StreamStdout, Text: "second line"},
+		{Stream: handlers.StreamStderr, Text: "no newline"},
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("line count = %d, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i := range want {
+		if lines[i].Stream != want[i].Stream || lines[i].Text != want[i].Text {
+			t.Errorf("line %d = %s %q, want %s %q", i, lines[i].Stream, lines[i].Text, want[i].Stream, want[i].Text)
+		}
+		if lines[i].Time.IsZero() {
+			t.Errorf("line %d has no timestamp", i)
+		}
+	}
+}
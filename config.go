@@ -0,0 +1,1007 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zishida/failhook/handlers"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the contents of a configuration file
+type Config struct {
+	Options  OptionsConfig   `json:"options" yaml:"options" toml:"options"`
+	Handlers []HandlerConfig `json:"handlers" yaml:"handlers" toml:"handlers"`
+}
+
+// OptionsConfig holds the options that can also be set by command line flags.
+// Unset options are nil so that they do not override flag defaults.
+type OptionsConfig struct {
+	Timeout           *int     `json:"timeout" yaml:"timeout" toml:"timeout"`
+	ExitPolicy        *string  `json:"exit_policy" yaml:"exit_policy" toml:"exit_policy"`
+	Passthrough       *string  `json:"passthrough" yaml:"passthrough" toml:"passthrough"`
+	Capture           *string  `json:"capture" yaml:"capture" toml:"capture"`
+	CaptureTags       *bool    `json:"capture_tags" yaml:"capture_tags" toml:"capture_tags"`
+	CaptureTimestamps *bool    `json:"capture_timestamps" yaml:"capture_timestamps" toml:"capture_timestamps"`
+	MaskArgs          *bool    `json:"mask_args" yaml:"mask_args" toml:"mask_args"`
+	MaskPatterns      []string `json:"mask_patterns" yaml:"mask_patterns" toml:"mask_patterns"`
+	Debug             *bool    `json:"debug" yaml:"debug" toml:"debug"`
+
+	HandlerTimeout      *string `json:"handler_timeout" yaml:"handler_timeout" toml:"handler_timeout"`
+	TotalHandlerTimeout *string `json:"total_handler_timeout" yaml:"total_handler_timeout" toml:"total_handler_timeout"`
+	HandlerRetries      *int    `json:"handler_retries" yaml:"handler_retries" toml:"handler_retries"`
+	HandlerRetryDelay   *string `json:"handler_retry_delay" yaml:"handler_retry_delay" toml:"handler_retry_delay"`
+	Parallel            *int    `json:"parallel" yaml:"parallel" toml:"parallel"`
+
+	Retries       *int    `json:"retries" yaml:"retries" toml:"retries"`
+	RetryDelay    *string `json:"retry_delay" yaml:"retry_delay" toml:"retry_delay"`
+	RetryBackoff  *string `json:"retry_backoff" yaml:"retry_backoff" toml:"retry_backoff"`
+	RetryMaxDelay *string `json:"retry_max_delay" yaml:"retry_max_delay" toml:"retry_max_delay"`
+
+	IgnoreCodes ExitCodeList `json:"ignore_codes" yaml:"ignore_codes" toml:"ignore_codes"`
+	OnlyCodes   ExitCodeList `json:"only_codes" yaml:"only_codes" toml:"only_codes"`
+
+	FailOnRegex    []string `json:"fail_on_regex" yaml:"fail_on_regex" toml:"fail_on_regex"`
+	FailOnStderr   *bool    `json:"fail_on_stderr" yaml:"fail_on_stderr" toml:"fail_on_stderr"`
+	SuccessMarkers []string `json:"success_markers" yaml:"success_markers" toml:"success_markers"`
+
+	StateDir    *string `json:"state_dir" yaml:"state_dir" toml:"state_dir"`
+	Job         *string `json:"job" yaml:"job" toml:"job"`
+	ChangesOnly *bool   `json:"changes_only" yaml:"changes_only" toml:"changes_only"`
+}
+
+// Handler types accepted in HandlerConfig.Type
+const (
+	HandlerTypeCommand = "command"
+	HandlerTypeExec    = "exec"
+	HandlerTypeWebhook = "webhook"
+	HandlerTypeSyslog  = "syslog"
+	HandlerTypeSlack   = "slack"
+	HandlerTypeNotify  = "notify"
+	HandlerTypeHTTP    = "http"
+)
+
+// HandlerConfig describes one failure handler. Which fields apply depends on
+// Type.
+type HandlerConfig struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Type string `json:"type" yaml:"type" toml:"type"`
+
+	// Group names an ordering group; handlers of the same group run one
+	// after another instead of concurrently
+	Group string `json:"group" yaml:"group" toml:"group"`
+	// On lists the phases of a run the handler runs in: start, success,
+	// failure or finish. It defaults to failure.
+	On []string `json:"on" yaml:"on" toml:"on"`
+
+	// Timeout limits how long the handler may run, as a duration such as
+	// "30s". It overrides the handler_timeout option.
+	Timeout string `json:"timeout" yaml:"timeout" toml:"timeout"`
+	// Retries, RetryDelay and RetryMaxDelay override the handler_retries and
+	// handler_retry_delay options. Each attempt gets the full timeout.
+	Retries       *int   `json:"retries" yaml:"retries" toml:"retries"`
+	RetryDelay    string `json:"retry_delay" yaml:"retry_delay" toml:"retry_delay"`
+	RetryMaxDelay string `json:"retry_max_delay" yaml:"retry_max_delay" toml:"retry_max_delay"`
+
+	// Filter restricts the events the handler runs for
+	Filter *FilterConfig `json:"filter" yaml:"filter" toml:"filter"`
+	// RateLimit limits how often the handler runs, e.g. "5/1h". The send
+	// times are kept in RateLimitFile, by default a file named after the
+	// handler in the user's cache directory.
+	RateLimit     string `json:"rate_limit" yaml:"rate_limit" toml:"rate_limit"`
+	RateLimitFile string `json:"rate_limit_file" yaml:"rate_limit_file" toml:"rate_limit_file"`
+	// Fallback is run when the handler fails
+	Fallback *HandlerConfig `json:"fallback" yaml:"fallback" toml:"fallback"`
+	// job keys the default rate limit file; see SetJob
+	job string
+
+	// command and exec handlers
+	Command string   `json:"command" yaml:"command" toml:"command"`
+	Argv    []string `json:"argv" yaml:"argv" toml:"argv"`
+	Stdin   bool     `json:"stdin" yaml:"stdin" toml:"stdin"`
+
+	// webhook, notify and http handlers
+	URL string `json:"url" yaml:"url" toml:"url"`
+
+	// syslog and slack handlers
+	Message string `json:"message" yaml:"message" toml:"message"`
+
+	// slack handlers
+	Webhook string `json:"webhook" yaml:"webhook" toml:"webhook"`
+	Channel string `json:"channel" yaml:"channel" toml:"channel"`
+
+	// slack and http handlers
+	Username string `json:"username" yaml:"username" toml:"username"`
+
+	// http handlers
+	Method        string            `json:"method" yaml:"method" toml:"method"`
+	Headers       map[string]string `json:"headers" yaml:"headers" toml:"headers"`
+	Body          string            `json:"body" yaml:"body" toml:"body"`
+	BodyFile      string            `json:"body_file" yaml:"body_file" toml:"body_file"`
+	ContentType   string            `json:"content_type" yaml:"content_type" toml:"content_type"`
+	Password      string            `json:"password" yaml:"password" toml:"password"`
+	BearerToken   string            `json:"bearer_token" yaml:"bearer_token" toml:"bearer_token"`
+	SuccessStatus []int             `json:"success_status" yaml:"success_status" toml:"success_status"`
+
+	// webhook, slack and http handlers
+	SigningSecret   string `json:"signing_secret" yaml:"signing_secret" toml:"signing_secret"`
+	SignatureHeader string `json:"signature_header" yaml:"signature_header" toml:"signature_header"`
+	SignatureFormat string `json:"signature_format" yaml:"signature_format" toml:"signature_format"`
+}
+
+// FilterConfig restricts the events a handler runs for. A handler runs only
+// for events whose exit code or class is listed, if exit_codes or classes
+// are set, and whose output matches, if output is set.
+type FilterConfig struct {
+	// ExitCodes lists the exit codes to run for
+	ExitCodes ExitCodeList `json:"exit_codes" yaml:"exit_codes" toml:"exit_codes"`
+	// Classes lists the failure classes to run for: timeout, interrupt,
+	// signal, exit or output
+	Classes []string `json:"classes" yaml:"classes" toml:"classes"`
+	// Output is a regular expression the combined output must match
+	Output string `json:"output" yaml:"output" toml:"output"`
+	// Changed runs the handler only when the job starts failing or
+	// recovers; it requires the state_dir option
+	Changed bool `json:"changed" yaml:"changed" toml:"changed"`
+}
+
+// Validate checks the filter. Errors start with the offending key.
+func (fc *FilterConfig) Validate() error {
+	if fc.ExitCodes == nil && fc.Classes == nil && fc.Output == "" && !fc.Changed {
+		return fmt.Errorf("filter: needs exit_codes, classes, output or changed")
+	}
+	if fc.ExitCodes != nil {
+		if _, err := fc.ExitCodes.Parse(); err != nil {
+			return fmt.Errorf("filter.exit_codes: %v", err)
+		}
+	}
+	for i, class := range fc.Classes {
+		if !handlers.ValidClass(class) {
+			return fmt.Errorf("filter.classes[%d]: unknown class %q (want timeout, interrupt, signal, exit or output)", i, class)
+		}
+	}
+	if fc.Output != "" {
+		if _, err := regexp.Compile(fc.Output); err != nil {
+			return fmt.Errorf("filter.output: %v", err)
+		}
+	}
+	return nil
+}
+
+// EventFilter returns the filter as a handlers.EventFilter
+func (fc *FilterConfig) EventFilter() handlers.EventFilter {
+	var when, filters []handlers.EventFilter
+	if fc.ExitCodes != nil {
+		codes, _ := fc.ExitCodes.Parse()
+		when = append(when, codes.Filter())
+	}
+	if fc.Classes != nil {
+		when = append(when, handlers.ClassFilter(fc.Classes...))
+	}
+	if len(when) > 0 {
+		filters = append(filters, handlers.AnyFilter(when...))
+	}
+	if fc.Output != "" {
+		filters = append(filters, handlers.OutputFilter(regexp.MustCompile(fc.Output)))
+	}
+	if fc.Changed {
+		filters = append(filters, handlers.ChangedFilter())
+	}
+	return handlers.AllFilters(filters...)
+}
+
+// ExitCodeList is a list of exit codes and ranges in a configuration file. It
+// may be written as a list such as [1, 3, "64-78"] or as a string such as
+// "1,3,64-78".
+type ExitCodeList []string
+
+// Parse returns the exit codes in the list
+func (l ExitCodeList) Parse() (handlers.ExitCodes, error) {
+	return handlers.ParseExitCodes(strings.Join(l, ","))
+}
+
+// setValue sets the list from a decoded string, number or list of them
+func (l *ExitCodeList) setValue(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*l = ExitCodeList{v}
+	case []interface{}:
+		list := make(ExitCodeList, 0, len(v))
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				list = append(list, item)
+			case int64, float64, int:
+				list = append(list, fmt.Sprint(item))
+			default:
+				return fmt.Errorf("exit codes must be numbers or ranges such as \"64-78\"")
+			}
+		}
+		*l = list
+	default:
+		return fmt.Errorf("exit codes must be a list or a string such as \"1,3,64-78\"")
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *ExitCodeList) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return l.setValue(value)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *ExitCodeList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*l = ExitCodeList{node.Value}
+	case yaml.SequenceNode:
+		list := make(ExitCodeList, len(node.Content))
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: exit codes must be numbers or ranges such as \"64-78\"", item.Line)
+			}
+			list[i] = item.Value
+		}
+		*l = list
+	default:
+		return fmt.Errorf("line %d: exit codes must be a list or a string such as \"1,3,64-78\"", node.Line)
+	}
+	return nil
+}
+
+// UnmarshalTOML implements toml.Unmarshaler
+func (l *ExitCodeList) UnmarshalTOML(value interface{}) error {
+	return l.setValue(value)
+}
+
+// handlerFields lists the fields each handler type accepts besides name and type
+var handlerFields = map[string][]string{
+	HandlerTypeCommand: {"command", "stdin"},
+	HandlerTypeExec:    {"argv", "stdin"},
+	HandlerTypeWebhook: {"url", "signing_secret", "signature_header", "signature_format"},
+	HandlerTypeSyslog:  {"message"},
+	HandlerTypeSlack:   {"webhook", "message", "channel", "username", "signing_secret", "signature_header", "signature_format"},
+	HandlerTypeNotify:  {"url"},
+	HandlerTypeHTTP: {"url", "method", "headers", "body", "body_file", "content_type",
+		"username", "password", "bearer_token", "success_status",
+		"signing_secret", "signature_header", "signature_format"},
+}
+
+// httpMethod matches a valid HTTP method token
+var httpMethod = regexp.MustCompile("^[A-Za-z]+$")
+
+// DefaultSlackMessage is the Slack message used when none is configured
+const DefaultSlackMessage = "Command __SUMMARY__\n```\n__OUTPUT__\n```"
+
+// LoadConfig reads and validates a configuration file. The format is chosen
+// by the file extension: .yaml or .yml, .toml, or .json.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := ParseConfig(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig decodes and validates configuration data in the format given
+// by ext. Unknown keys are rejected.
+func ParseConfig(data []byte, ext string) (*Config, error) {
+	var cfg Config
+
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &cfg)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown key %s", undecoded[0])
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q (want .yaml, .yml, .toml or .json)", ext)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the options and every handler and reports the first
+// problem found, naming the offending key
+func (c *Config) Validate() error {
+	if err := c.Options.Validate(); err != nil {
+		return fmt.Errorf("options.%v", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Handlers {
+		hc := &c.Handlers[i]
+		key := fmt.Sprintf("handlers[%d]", i)
+
+		if hc.Name == "" {
+			return fmt.Errorf("%s.name: required", key)
+		}
+		if names[hc.Name] {
+			return fmt.Errorf("%s.name: duplicate handler name %q", key, hc.Name)
+		}
+		names[hc.Name] = true
+
+		if err := hc.Validate(); err != nil {
+			return fmt.Errorf("%s (%s).%v", key, hc.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the handler has the fields its type requires and no
+// fields of other types. Errors start with the offending key.
+func (hc *HandlerConfig) Validate() error {
+	allowed, ok := handlerFields[hc.Type]
+	if !ok {
+		return fmt.Errorf("type: unknown handler type %q (want command, exec, webhook, syslog, slack, notify or http)", hc.Type)
+	}
+
+	set := map[string]bool{
+		"command":  hc.Command != "",
+		"argv":     hc.Argv != nil,
+		"stdin":    hc.Stdin,
+		"url":      hc.URL != "",
+		"message":  hc.Message != "",
+		"webhook":  hc.Webhook != "",
+		"channel":  hc.Channel != "",
+		"username": hc.Username != "",
+
+		"method":         hc.Method != "",
+		"headers":        hc.Headers != nil,
+		"body":           hc.Body != "",
+		"body_file":      hc.BodyFile != "",
+		"content_type":   hc.ContentType != "",
+		"password":       hc.Password != "",
+		"bearer_token":   hc.BearerToken != "",
+		"success_status": hc.SuccessStatus != nil,
+
+		"signing_secret":   hc.SigningSecret != "",
+		"signature_header": hc.SignatureHeader != "",
+		"signature_format": hc.SignatureFormat != "",
+	}
+	for _, field := range allowed {
+		delete(set, field)
+	}
+	for _, field := range []string{"command", "argv", "stdin", "url", "message", "webhook", "channel", "username",
+		"method", "headers", "body", "body_file", "content_type", "password", "bearer_token", "success_status",
+		"signing_secret", "signature_header", "signature_format"} {
+		if set[field] {
+			return fmt.Errorf("%s: not valid for %s handlers", field, hc.Type)
+		}
+	}
+
+	if hc.Retries != nil && *hc.Retries < 0 {
+		return fmt.Errorf("retries: must not be negative")
+	}
+	for key, value := range map[string]string{
+		"timeout":         hc.Timeout,
+		"retry_delay":     hc.RetryDelay,
+		"retry_max_delay": hc.RetryMaxDelay,
+	} {
+		if value != "" {
+			if _, err := parseTimeout(value); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	if hc.Retries == nil && (hc.RetryDelay != "" || hc.RetryMaxDelay != "") {
+		return fmt.Errorf("retry_delay: requires retries")
+	}
+	if err := hc.validateMiddleware(); err != nil {
+		return err
+	}
+
+	var required string
+	switch hc.Type {
+	case HandlerTypeCommand:
+		if hc.Command == "" {
+			required = "command"
+		}
+	case HandlerTypeExec:
+		if len(hc.Argv) == 0 {
+			required = "argv"
+		}
+	case HandlerTypeWebhook, HandlerTypeNotify, HandlerTypeHTTP:
+		if hc.URL == "" {
+			required = "url"
+		}
+	case HandlerTypeSyslog:
+		if hc.Message == "" {
+			required = "message"
+		}
+	case HandlerTypeSlack:
+		if hc.Webhook == "" {
+			required = "webhook"
+		}
+	}
+	if required != "" {
+		return fmt.Errorf("%s: required for %s handlers", required, hc.Type)
+	}
+	if hc.Type == HandlerTypeHTTP {
+		if err := hc.validateHTTP(); err != nil {
+			return err
+		}
+	}
+	if err := hc.validateSigning(); err != nil {
+		return err
+	}
+	if hc.Type == HandlerTypeNotify && !isSecretRef(hc.URL) {
+		if _, err := handlers.NewHandlerFromURL(hc.URL); err != nil {
+			return fmt.Errorf("url: %v", err)
+		}
+	}
+
+	// Check the placeholder expressions of every template
+	registry := handlers.NewPlaceholderRegistry()
+	templates := map[string]string{
+		"command": hc.Command,
+		"url":     hc.URL,
+		"message": hc.Message,
+		"body":    hc.Body,
+	}
+	for name, value := range hc.Headers {
+		templates["headers."+name] = value
+	}
+	for i, arg := range hc.Argv {
+		templates[fmt.Sprintf("argv[%d]", i)] = arg
+	}
+	for field, template := range templates {
+		if err := registry.Validate(template); err != nil {
+			return fmt.Errorf("%s: %v", field, err)
+		}
+	}
+
+	return nil
+}
+
+// validateMiddleware checks the phase, filter, rate limit and fallback
+// settings
+func (hc *HandlerConfig) validateMiddleware() error {
+	for i, phase := range hc.On {
+		if !handlers.ValidPhase(phase) {
+			return fmt.Errorf("on[%d]: unknown phase %q (want start, success, failure or finish)", i, phase)
+		}
+	}
+	if hc.Filter != nil {
+		if err := hc.Filter.Validate(); err != nil {
+			return err
+		}
+	}
+	if hc.RateLimit != "" {
+		if _, _, err := handlers.ParseRateLimit(hc.RateLimit); err != nil {
+			return fmt.Errorf("rate_limit: %v", err)
+		}
+	} else if hc.RateLimitFile != "" {
+		return fmt.Errorf("rate_limit_file: requires rate_limit")
+	}
+	if fb := hc.Fallback; fb != nil {
+		if fb.Group != "" {
+			return fmt.Errorf("fallback.group: not valid for fallback handlers")
+		}
+		if fb.On != nil {
+			return fmt.Errorf("fallback.on: not valid for fallback handlers")
+		}
+		fallback := hc.fallbackConfig()
+		if err := fallback.Validate(); err != nil {
+			return fmt.Errorf("fallback.%v", err)
+		}
+	}
+	return nil
+}
+
+// Phases returns the phases of a run the handler runs in
+func (hc *HandlerConfig) Phases() []string {
+	if len(hc.On) == 0 {
+		return []string{handlers.PhaseFailure}
+	}
+	return hc.On
+}
+
+// fallbackConfig returns the configuration of the fallback handler, named
+// after its handler unless it has a name of its own
+func (hc *HandlerConfig) fallbackConfig() HandlerConfig {
+	fallback := *hc.Fallback
+	if fallback.Name == "" {
+		fallback.Name = hc.Name + ".fallback"
+	}
+	fallback.job = hc.job
+	return fallback
+}
+
+// SetJob names the job the handler reports on. The default rate limit file
+// is kept per job, so that jobs sharing a configuration file do not share
+// the rate limits of their handlers.
+func (hc *HandlerConfig) SetJob(job string) {
+	hc.job = job
+}
+
+// rateLimitFile returns the file keeping the rate limit state of hc
+func (hc *HandlerConfig) rateLimitFile() (string, error) {
+	if hc.RateLimitFile != "" {
+		return hc.RateLimitFile, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("rate_limit: %v; set rate_limit_file", err)
+	}
+	dir = filepath.Join(dir, "failhook", "ratelimit")
+	if hc.job != "" {
+		dir = filepath.Join(dir, JobFileName(hc.job))
+	}
+	return filepath.Join(dir, JobFileName(hc.Name)+".json"), nil
+}
+
+// validateHTTP checks the fields specific to http handlers
+func (hc *HandlerConfig) validateHTTP() error {
+	if hc.Method != "" && !httpMethod.MatchString(hc.Method) {
+		return fmt.Errorf("method: invalid HTTP method %q", hc.Method)
+	}
+	if hc.Body != "" && hc.BodyFile != "" {
+		return fmt.Errorf("body_file: cannot be combined with body")
+	}
+	if hc.BearerToken != "" && (hc.Username != "" || hc.Password != "") {
+		return fmt.Errorf("bearer_token: cannot be combined with username and password")
+	}
+	for name := range hc.Headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("headers.%s: invalid header name", name)
+		}
+	}
+	for i, code := range hc.SuccessStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("success_status[%d]: %d is not an HTTP status code", i, code)
+		}
+	}
+	return nil
+}
+
+// validateSigning checks the request signing fields
+func (hc *HandlerConfig) validateSigning() error {
+	if hc.SigningSecret == "" {
+		if hc.SignatureHeader != "" {
+			return fmt.Errorf("signature_header: requires signing_secret")
+		}
+		if hc.SignatureFormat != "" {
+			return fmt.Errorf("signature_format: requires signing_secret")
+		}
+		return nil
+	}
+	if hc.SignatureHeader != "" && !validHeaderName(hc.SignatureHeader) {
+		return fmt.Errorf("signature_header: invalid header name %q", hc.SignatureHeader)
+	}
+	if hc.SignatureFormat != "" && !handlers.ValidSignatureFormat(hc.SignatureFormat) {
+		return fmt.Errorf("signature_format: unknown signature format %q (want stripe or github)", hc.SignatureFormat)
+	}
+	if hc.SignatureFormat == handlers.SignatureFormatGitHub && hc.Type == HandlerTypeWebhook {
+		return fmt.Errorf("signature_format: github signs only the body, which webhook requests do not have; use stripe")
+	}
+	return nil
+}
+
+// signer returns the request signer described by hc, or nil if requests are
+// not signed
+func (hc *HandlerConfig) signer() *handlers.Signer {
+	if hc.SigningSecret == "" {
+		return nil
+	}
+	var options []func(*handlers.Signer)
+	if hc.SignatureFormat != "" {
+		options = append(options, handlers.WithSignatureFormat(hc.SignatureFormat))
+	}
+	if hc.SignatureHeader != "" {
+		options = append(options, handlers.WithSignatureHeader(hc.SignatureHeader))
+	}
+	return handlers.NewSigner(hc.SigningSecret, options...)
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveSecrets returns a copy of hc with env:NAME and file:PATH references
+// in its settings replaced by the values they point to. Errors start with the
+// offending key.
+func (hc *HandlerConfig) ResolveSecrets() (HandlerConfig, error) {
+	type field struct {
+		key   string
+		value *string
+	}
+
+	resolved := *hc
+	fields := []field{
+		{"command", &resolved.Command},
+		{"url", &resolved.URL},
+		{"message", &resolved.Message},
+		{"webhook", &resolved.Webhook},
+		{"channel", &resolved.Channel},
+		{"username", &resolved.Username},
+		{"password", &resolved.Password},
+		{"bearer_token", &resolved.BearerToken},
+		{"signing_secret", &resolved.SigningSecret},
+	}
+	if hc.Headers != nil {
+		resolved.Headers = make(map[string]string, len(hc.Headers))
+		for name, value := range hc.Headers {
+			value, err := ResolveSecret(value)
+			if err != nil {
+				return HandlerConfig{}, fmt.Errorf("headers.%s: %v", name, err)
+			}
+			resolved.Headers[name] = value
+		}
+	}
+	if hc.Argv != nil {
+		resolved.Argv = append([]string(nil), hc.Argv...)
+		for i := range resolved.Argv {
+			fields = append(fields, field{fmt.Sprintf("argv[%d]", i), &resolved.Argv[i]})
+		}
+	}
+
+	for _, f := range fields {
+		value, err := ResolveSecret(*f.value)
+		if err != nil {
+			return HandlerConfig{}, fmt.Errorf("%s: %v", f.key, err)
+		}
+		*f.value = value
+	}
+	return resolved, nil
+}
+
+// parseTimeout parses a non-negative duration such as "30s" or "2m"
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// ApplyDefaultTimeout gives a handler that has retries of its own but no
+// timeout the default timeout, so that Build applies it to each attempt.
+// Otherwise FailHook would wrap the default around the retries and limit
+// all attempts together. Fallback handlers get the default as well; a zero
+// timeout changes nothing.
+func (hc *HandlerConfig) ApplyDefaultTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	if hc.Retries != nil && hc.Timeout == "" {
+		hc.Timeout = timeout.String()
+	}
+	if hc.Fallback != nil {
+		fallback := *hc.Fallback
+		fallback.ApplyDefaultTimeout(timeout)
+		hc.Fallback = &fallback
+	}
+}
+
+// Build creates the handler described by hc, resolving secret references.
+// The handler is wrapped, from the inside out, with handlers.WithTimeout,
+// handlers.WithRetry, handlers.WithRateLimit, handlers.WithFallback and
+// handlers.WithFilter as configured.
+func (hc *HandlerConfig) Build() (handlers.FailureHandler, error) {
+	handler, err := hc.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if hc.Timeout != "" {
+		timeout, _ := parseTimeout(hc.Timeout)
+		handler = handlers.WithTimeout(handlers.AdaptHandler(handler), timeout)
+	}
+	if hc.Retries != nil {
+		policy := handlers.DefaultRetryPolicy(*hc.Retries)
+		if hc.RetryDelay != "" {
+			policy.InitialDelay, _ = parseTimeout(hc.RetryDelay)
+		}
+		if hc.RetryMaxDelay != "" {
+			policy.MaxDelay, _ = parseTimeout(hc.RetryMaxDelay)
+		}
+		handler = handlers.WithRetry(handlers.AdaptHandler(handler), policy)
+	}
+	if hc.RateLimit != "" {
+		limit, window, _ := handlers.ParseRateLimit(hc.RateLimit)
+		file, err := hc.rateLimitFile()
+		if err != nil {
+			return nil, err
+		}
+		handler = handlers.WithRateLimit(handlers.AdaptHandler(handler), limit, window, handlers.WithRateLimitFile(file))
+	}
+	if hc.Fallback != nil {
+		fallbackConfig := hc.fallbackConfig()
+		fallback, err := fallbackConfig.Build()
+		if err != nil {
+			return nil, fmt.Errorf("fallback.%v", err)
+		}
+		handler = handlers.WithFallback(handlers.AdaptHandler(handler), handlers.AdaptHandler(fallback))
+	}
+	if hc.Filter != nil {
+		handler = handlers.WithFilter(handlers.AdaptHandler(handler), hc.Filter.EventFilter())
+	}
+	return handler, nil
+}
+
+// build creates the handler described by hc without its timeout
+func (hc *HandlerConfig) build() (handlers.FailureHandler, error) {
+	resolved, err := hc.ResolveSecrets()
+	if err != nil {
+		return nil, err
+	}
+	hc = &resolved
+	if hc.BodyFile != "" {
+		data, err := os.ReadFile(hc.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("body_file: %v", err)
+		}
+		hc.Body, hc.BodyFile = string(data), ""
+	}
+	if err := hc.Validate(); err != nil {
+		return nil, err
+	}
+
+	var commandOptions []func(*handlers.CommandHandler)
+	if hc.Stdin {
+		commandOptions = append(commandOptions, handlers.WithEventStdin())
+	}
+
+	switch hc.Type {
+	case HandlerTypeCommand:
+		return handlers.NewCommandHandler(hc.Command, commandOptions...), nil
+	case HandlerTypeExec:
+		return handlers.NewExecHandler(hc.Argv, commandOptions...), nil
+	case HandlerTypeWebhook:
+		var webhookOptions []func(*handlers.WebhookHandler)
+		if signer := hc.signer(); signer != nil {
+			webhookOptions = append(webhookOptions, handlers.WithWebhookSigner(signer))
+		}
+		return handlers.NewWebhookHandler(hc.URL, webhookOptions...), nil
+	case HandlerTypeSyslog:
+		return handlers.NewSyslogHandler(hc.Message), nil
+	case HandlerTypeSlack:
+		message := hc.Message
+		if message == "" {
+			message = DefaultSlackMessage
+		}
+		var slackOptions []func(*handlers.SlackHandler)
+		if hc.Channel != "" {
+			slackOptions = append(slackOptions, handlers.WithChannel(hc.Channel))
+		}
+		if hc.Username != "" {
+			slackOptions = append(slackOptions, handlers.WithUsername(hc.Username))
+		}
+		if signer := hc.signer(); signer != nil {
+			slackOptions = append(slackOptions, handlers.WithSlackSigner(signer))
+		}
+		return handlers.NewSlackHandler(hc.Webhook, message, slackOptions...), nil
+	case HandlerTypeNotify:
+		return handlers.NewHandlerFromURL(hc.URL)
+	case HandlerTypeHTTP:
+		httpOptions := []func(*handlers.HTTPHandler){
+			handlers.WithMethod(hc.Method),
+			handlers.WithBody(hc.Body),
+			handlers.WithContentType(hc.ContentType),
+			handlers.WithSuccessStatus(hc.SuccessStatus...),
+		}
+		names := make([]string, 0, len(hc.Headers))
+		for name := range hc.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			httpOptions = append(httpOptions, handlers.WithHeader(name, hc.Headers[name]))
+		}
+		if hc.BearerToken != "" {
+			httpOptions = append(httpOptions, handlers.WithBearerToken(hc.BearerToken))
+		} else if hc.Username != "" || hc.Password != "" {
+			httpOptions = append(httpOptions, handlers.WithBasicAuth(hc.Username, hc.Password))
+		}
+		if signer := hc.signer(); signer != nil {
+			httpOptions = append(httpOptions, handlers.WithSigner(signer))
+		}
+		return handlers.NewHTTPHandler(hc.URL, httpOptions...), nil
+	}
+	return nil, fmt.Errorf("type: unknown handler type %q", hc.Type)
+}
+
+// Validate checks the option values. Errors start with the offending key.
+func (o *OptionsConfig) Validate() error {
+	if o.Timeout != nil && *o.Timeout < 0 {
+		return fmt.Errorf("timeout: must not be negative")
+	}
+	if o.ExitPolicy != nil && !validExitPolicy(*o.ExitPolicy) {
+		return fmt.Errorf("exit_policy: unknown exit policy %q (want child, handler or zero)", *o.ExitPolicy)
+	}
+	if o.Passthrough != nil {
+		if err := NewFailHook(false).SetPassthroughMode(*o.Passthrough); err != nil {
+			return fmt.Errorf("passthrough: %v", err)
+		}
+	}
+	if o.Capture != nil {
+		if err := NewFailHook(false).SetCaptureMode(*o.Capture, false, false); err != nil {
+			return fmt.Errorf("capture: %v", err)
+		}
+	}
+	if o.Parallel != nil && *o.Parallel < 0 {
+		return fmt.Errorf("parallel: must not be negative")
+	}
+	if o.HandlerRetries != nil && *o.HandlerRetries < 0 {
+		return fmt.Errorf("handler_retries: must not be negative")
+	}
+	if o.Retries != nil && *o.Retries < 0 {
+		return fmt.Errorf("retries: must not be negative")
+	}
+	if o.RetryBackoff != nil {
+		if _, err := CommandRetryPolicy(0, 0, *o.RetryBackoff, 0); err != nil {
+			return fmt.Errorf("retry_backoff: %v", err)
+		}
+	}
+	for key, value := range map[string]ExitCodeList{
+		"ignore_codes": o.IgnoreCodes,
+		"only_codes":   o.OnlyCodes,
+	} {
+		if value != nil {
+			if _, err := value.Parse(); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	for key, value := range map[string]*string{
+		"handler_timeout":       o.HandlerTimeout,
+		"total_handler_timeout": o.TotalHandlerTimeout,
+		"handler_retry_delay":   o.HandlerRetryDelay,
+		"retry_delay":           o.RetryDelay,
+		"retry_max_delay":       o.RetryMaxDelay,
+	} {
+		if value != nil {
+			if _, err := parseTimeout(*value); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+	for key, patterns := range map[string][]string{
+		"mask_patterns":   o.MaskPatterns,
+		"fail_on_regex":   o.FailOnRegex,
+		"success_markers": o.SuccessMarkers,
+	} {
+		for i, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s[%d]: %v", key, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply sets the flags in fs for every configured option whose flag was not
+// given on the command line, so command line flags take precedence
+func (o *OptionsConfig) Apply(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	type option struct {
+		key    string
+		flag   string
+		values []string
+	}
+	var options []option
+
+	addString := func(key, flagName string, v *string) {
+		if v != nil {
+			options = append(options, option{key, flagName, []string{*v}})
+		}
+	}
+	addBool := func(key, flagName string, v *bool) {
+		if v != nil {
+			options = append(options, option{key, flagName, []string{strconv.FormatBool(*v)}})
+		}
+	}
+
+	if o.Timeout != nil {
+		options = append(options, option{"timeout", "timeout", []string{strconv.Itoa(*o.Timeout)}})
+	}
+	addString("exit_policy", "exit-policy", o.ExitPolicy)
+	addString("passthrough", "passthrough", o.Passthrough)
+	addString("capture", "capture", o.Capture)
+	addBool("capture_tags", "capture-tags", o.CaptureTags)
+	addBool("capture_timestamps", "capture-timestamps", o.CaptureTimestamps)
+	addBool("mask_args", "mask-args", o.MaskArgs)
+	if o.MaskPatterns != nil {
+		options = append(options, option{"mask_patterns", "mask-pattern", o.MaskPatterns})
+	}
+	addBool("debug", "d", o.Debug)
+	addString("handler_timeout", "handler-timeout", o.HandlerTimeout)
+	addString("total_handler_timeout", "total-handler-timeout", o.TotalHandlerTimeout)
+	if o.HandlerRetries != nil {
+		options = append(options, option{"handler_retries", "handler-retries", []string{strconv.Itoa(*o.HandlerRetries)}})
+	}
+	addString("handler_retry_delay", "handler-retry-delay", o.HandlerRetryDelay)
+	if o.Parallel != nil {
+		options = append(options, option{"parallel", "parallel", []string{strconv.Itoa(*o.Parallel)}})
+	}
+	if o.Retries != nil {
+		options = append(options, option{"retries", "retries", []string{strconv.Itoa(*o.Retries)}})
+	}
+	addString("retry_delay", "retry-delay", o.RetryDelay)
+	addString("retry_backoff", "retry-backoff", o.RetryBackoff)
+	addString("retry_max_delay", "retry-max-delay", o.RetryMaxDelay)
+	if o.IgnoreCodes != nil {
+		options = append(options, option{"ignore_codes", "ignore-codes", []string{strings.Join(o.IgnoreCodes, ",")}})
+	}
+	if o.OnlyCodes != nil {
+		options = append(options, option{"only_codes", "only-codes", []string{strings.Join(o.OnlyCodes, ",")}})
+	}
+	if o.FailOnRegex != nil {
+		options = append(options, option{"fail_on_regex", "fail-on-regex", o.FailOnRegex})
+	}
+	addBool("fail_on_stderr", "fail-on-stderr", o.FailOnStderr)
+	if o.SuccessMarkers != nil {
+		options = append(options, option{"success_markers", "success-marker", o.SuccessMarkers})
+	}
+	addString("state_dir", "state-dir", o.StateDir)
+	addString("job", "job", o.Job)
+	addBool("changes_only", "changes-only", o.ChangesOnly)
+
+	for _, opt := range options {
+		if given[opt.flag] {
+			continue
+		}
+		for _, value := range opt.values {
+			if err := fs.Set(opt.flag, value); err != nil {
+				return fmt.Errorf("options.%s: %v", opt.key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,746 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+const testYAMLConfig = `
+options:
+  timeout: 30
+  capture: interleaved
+handlers:
+  - name: ops-webhook
+    type: webhook
+    url: https://example.com/hook?code=__STATUS_CODE__
+  - name: team-slack
+    type: slack
+    webhook: https://hooks.slack.com/services/XXX
+    channel: "#team"
+    message: "{{stderr | tail 20}}"
+`
+
+const testTOMLConfig = `
+[options]
+timeout = 30
+capture = "interleaved"
+
+[[handlers]]
+name = "ops-webhook"
+type = "webhook"
+url = "https://example.com/hook?code=__STATUS_CODE__"
+
+[[handlers]]
+name = "team-slack"
+type = "slack"
+webhook = "https://hooks.slack.com/services/XXX"
+channel = "#team"
+message = "{{stderr | tail 20}}"
+`
+
+const testJSONConfig = `{
+  "options": {"timeout": 30, "capture": "interleaved"},
+  "handlers": [
+    {"name": "ops-webhook", "type": "webhook", "url": "https://example.com/hook?code=__STATUS_CODE__"},
+    {"name": "team-slack", "type": "slack", "webhook": "https://hooks.slack.com/services/XXX",
+     "channel": "#team", "message": "{{stderr | tail 20}}"}
+  ]
+}`
+
+func TestParseConfigFormats(t *testing.T) {
+	tests := []struct {
+		ext  string
+		data string
+	}{
+		{".yaml", testYAMLConfig},
+		{".toml", testTOMLConfig},
+		{".json", testJSONConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.data), tt.ext)
+			if err != nil {
+				t.Fatalf("ParseConfig failed: %v", err)
+			}
+
+			if cfg.Options.Timeout == nil || *cfg.Options.Timeout != 30 {
+				t.Errorf("timeout = %v, want 30", cfg.Options.Timeout)
+			}
+			if cfg.Options.Capture == nil || *cfg.Options.Capture != CaptureInterleaved {
+				t.Errorf("capture = %v, want %q", cfg.Options.Capture, CaptureInterleaved)
+			}
+			if cfg.Options.ExitPolicy != nil {
+				t.Errorf("exit_policy = %q, want unset", *cfg.Options.ExitPolicy)
+			}
+
+			if len(cfg.Handlers) != 2 {
+				t.Fatalf("handler count = %d, want 2", len(cfg.Handlers))
+			}
+			slack := cfg.Handlers[1]
+			if slack.Name != "team-slack" || slack.Type != HandlerTypeSlack || slack.Channel != "#team" {
+				t.Errorf("handler = %+v", slack)
+			}
+
+			for _, hc := range cfg.Handlers {
+				if _, err := hc.Build(); err != nil {
+					t.Errorf("Build(%s) failed: %v", hc.Name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "unknown format",
+			ext:     ".ini",
+			data:    "",
+			wantErr: "unknown configuration format",
+		},
+		{
+			name:    "unknown YAML key",
+			ext:     ".yaml",
+			data:    "handlers:\n  - name: a\n    type: webhook\n    uri: x\n",
+			wantErr: "uri",
+		},
+		{
+			name:    "unknown TOML key",
+			ext:     ".toml",
+			data:    "[options]\ntimeuot = 3\n",
+			wantErr: "options.timeuot",
+		},
+		{
+			name:    "unknown JSON key",
+			ext:     ".json",
+			data:    `{"handler": []}`,
+			wantErr: "handler",
+		},
+		{
+			name:    "missing name",
+			ext:     ".yaml",
+			data:    "handlers:\n  - type: webhook\n    url: x\n",
+			wantErr: "handlers[0].name: required",
+		},
+		{
+			name:    "duplicate name",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: a, type: syslog, message: x}\n  - {name: a, type: syslog, message: y}\n",
+			wantErr: "handlers[1].name: duplicate",
+		},
+		{
+			name:    "unknown type",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: a, type: pager}\n",
+			wantErr: "handlers[0] (a).type: unknown handler type",
+		},
+		{
+			name:    "missing required field",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: hook, type: webhook}\n",
+			wantErr: "handlers[0] (hook).url: required for webhook handlers",
+		},
+		{
+			name:    "field of another type",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: hook, type: webhook, url: x, channel: '#a'}\n",
+			wantErr: "handlers[0] (hook).channel: not valid for webhook handlers",
+		},
+		{
+			name:    "invalid template",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: '{{output | sparkle}}'}\n",
+			wantErr: "handlers[0] (log).message: {{output | sparkle}}: unknown filter",
+		},
+		{
+			name:    "invalid exec argument",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: run, type: exec, argv: [notify, '{{nope}}']}\n",
+			wantErr: "handlers[0] (run).argv[1]",
+		},
+		{
+			name:    "unknown notification scheme",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: page, type: notify, url: 'pager://ops'}\n",
+			wantErr: "handlers[0] (page).url: unknown notification scheme",
+		},
+		{
+			name:    "http body and body_file",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: api, type: http, url: 'https://example.com', body: '{}', body_file: body.json}\n",
+			wantErr: "handlers[0] (api).body_file: cannot be combined with body",
+		},
+		{
+			name:    "http success status",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: api, type: http, url: 'https://example.com', success_status: [200, 42]}\n",
+			wantErr: "handlers[0] (api).success_status[1]: 42 is not an HTTP status code",
+		},
+		{
+			name:    "http header name",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: api, type: http, url: 'https://example.com', headers: {'X Bad': v}}\n",
+			wantErr: "handlers[0] (api).headers.X Bad: invalid header name",
+		},
+		{
+			name:    "signature format",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: hook, type: webhook, url: 'https://example.com', signing_secret: s, signature_format: gitlab}\n",
+			wantErr: "handlers[0] (hook).signature_format: unknown signature format",
+		},
+		{
+			name:    "signature header without secret",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: hook, type: webhook, url: 'https://example.com', signature_header: X-Sig}\n",
+			wantErr: "handlers[0] (hook).signature_header: requires signing_secret",
+		},
+		{
+			name:    "handler timeout",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, timeout: soon}\n",
+			wantErr: "handlers[0] (log).timeout: time: invalid duration",
+		},
+		{
+			name:    "handler timeout option",
+			ext:     ".yaml",
+			data:    "options:\n  total_handler_timeout: -1m\n",
+			wantErr: "options.total_handler_timeout: must not be negative",
+		},
+		{
+			name:    "negative parallelism",
+			ext:     ".yaml",
+			data:    "options:\n  parallel: -1\n",
+			wantErr: "options.parallel: must not be negative",
+		},
+		{
+			name:    "invalid filter",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, filter: {output: '('}}\n",
+			wantErr: "handlers[0] (log).filter.output: error parsing regexp",
+		},
+		{
+			name:    "invalid rate limit",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, rate_limit: often}\n",
+			wantErr: "handlers[0] (log).rate_limit: invalid rate limit",
+		},
+		{
+			name:    "invalid fallback",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, fallback: {type: slack}}\n",
+			wantErr: "handlers[0] (log).fallback.webhook: required for slack handlers",
+		},
+		{
+			name:    "unknown phase",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, on: [start, end]}\n",
+			wantErr: "handlers[0] (log).on[1]: unknown phase \"end\"",
+		},
+		{
+			name:    "github signature on webhook",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: hook, type: webhook, url: \"https://example.com\", signing_secret: x, signature_format: github}\n",
+			wantErr: "handlers[0] (hook).signature_format: github signs only the body",
+		},
+		{
+			name:    "phase on fallback",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, fallback: {type: syslog, message: y, on: [finish]}}\n",
+			wantErr: "handlers[0] (log).fallback.on: not valid for fallback handlers",
+		},
+		{
+			name:    "unknown fallback key",
+			ext:     ".json",
+			data:    `{"handlers": [{"name": "log", "type": "syslog", "message": "x", "fallback": {"type": "syslog", "msg": "x"}}]}`,
+			wantErr: `unknown field "msg"`,
+		},
+		{
+			name:    "invalid retry backoff",
+			ext:     ".yaml",
+			data:    "options:\n  retries: 3\n  retry_backoff: linear\n",
+			wantErr: "options.retry_backoff: unknown backoff",
+		},
+		{
+			name:    "invalid filter class",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, filter: {classes: [crash]}}\n",
+			wantErr: "handlers[0] (log).filter.classes[0]: unknown class \"crash\"",
+		},
+		{
+			name:    "invalid filter exit codes",
+			ext:     ".yaml",
+			data:    "handlers:\n  - {name: log, type: syslog, message: x, filter: {exit_codes: [\"9-2\"]}}\n",
+			wantErr: "handlers[0] (log).filter.exit_codes: invalid exit code range",
+		},
+		{
+			name:    "invalid ignore codes",
+			ext:     ".toml",
+			data:    "[options]\nignore_codes = \"1,300\"\n",
+			wantErr: "options.ignore_codes: invalid exit code",
+		},
+		{
+			name:    "invalid fail on regex",
+			ext:     ".yaml",
+			data:    "options:\n  fail_on_regex: ['ERROR', '[']\n",
+			wantErr: "options.fail_on_regex[1]",
+		},
+		{
+			name:    "invalid option",
+			ext:     ".yaml",
+			data:    "options:\n  exit_policy: sometimes\n",
+			wantErr: "options.exit_policy: unknown exit policy",
+		},
+		{
+			name:    "invalid mask pattern",
+			ext:     ".yaml",
+			data:    "options:\n  mask_patterns: ['(']\n",
+			wantErr: "options.mask_patterns[0]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.data), tt.ext)
+			if err == nil {
+				t.Fatalf("ParseConfig() error = nil, want %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseConfig() error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failhook.yml")
+	if err := os.WriteFile(path, []byte(testYAMLConfig), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Handlers) != 2 {
+		t.Errorf("handler count = %d, want 2", len(cfg.Handlers))
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadConfig() error = nil for missing file, want error")
+	}
+}
+
+func TestOptionsConfigApply(t *testing.T) {
+	var (
+		timeout      int
+		exitPolicy   string
+		debug        bool
+		maskPatterns stringList
+	)
+	fs := flag.NewFlagSet("failhook", flag.ContinueOnError)
+	fs.IntVar(&timeout, "timeout", 0, "")
+	fs.StringVar(&exitPolicy, "exit-policy", ExitPolicyChild, "")
+	fs.BoolVar(&debug, "d", false, "")
+	fs.Var(&maskPatterns, "mask-pattern", "")
+	ignoreCodes := fs.String("ignore-codes", "", "")
+	stateDir := fs.String("state-dir", "", "")
+	changesOnly := fs.Bool("changes-only", false, "")
+
+	// The timeout is given on the command line and must win
+	if err := fs.Parse([]string{"-timeout", "5"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cfg, err := ParseConfig([]byte(`
+options:
+  timeout: 60
+  exit_policy: handler
+  debug: true
+  mask_patterns: ["^s3://", "secret"]
+  ignore_codes: [1, "64-78"]
+  state_dir: /var/lib/failhook
+  changes_only: true
+`), ".yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	if err := cfg.Options.Apply(fs); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if timeout != 5 {
+		t.Errorf("timeout = %d, want command line value 5", timeout)
+	}
+	if exitPolicy != ExitPolicyHandler {
+		t.Errorf("exit policy = %q, want %q", exitPolicy, ExitPolicyHandler)
+	}
+	if !debug {
+		t.Error("debug = false, want true")
+	}
+	if len(maskPatterns) != 2 {
+		t.Errorf("mask patterns = %q, want 2 patterns", maskPatterns)
+	}
+	if *ignoreCodes != "1,64-78" {
+		t.Errorf("ignore codes = %q, want %q", *ignoreCodes, "1,64-78")
+	}
+	if *stateDir != "/var/lib/failhook" || !*changesOnly {
+		t.Errorf("state dir, changes only = %q, %v, want /var/lib/failhook, true", *stateDir, *changesOnly)
+	}
+}
+
+func TestFilterConfigChanged(t *testing.T) {
+	cfg, err := ParseConfig([]byte("handlers:\n  - {name: team, type: syslog, message: x, on: [success, failure], filter: {changed: true}}\n"), ".yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	filter := cfg.Handlers[0].Filter.EventFilter()
+
+	recovered := &handlers.FailureEvent{Outcome: handlers.OutcomeSuccess, PreviousOutcome: handlers.OutcomeFailure}
+	stillFailing := &handlers.FailureEvent{Outcome: handlers.OutcomeFailure, PreviousOutcome: handlers.OutcomeFailure}
+	if !filter(recovered) || filter(stillFailing) {
+		t.Errorf("filter(recovered), filter(still failing) = %v, %v, want true, false", filter(recovered), filter(stillFailing))
+	}
+}
+
+func TestHandlerConfigBuild(t *testing.T) {
+	tests := []struct {
+		config   HandlerConfig
+		wantDesc string
+	}{
+		{HandlerConfig{Name: "a", Type: HandlerTypeCommand, Command: "true"}, "Execute command: true"},
+		{HandlerConfig{Name: "b", Type: HandlerTypeExec, Argv: []string{"notify", "x"}}, "Execute command: notify x"},
+		{HandlerConfig{Name: "c", Type: HandlerTypeWebhook, URL: "https://example.com"}, "Call webhook: https://example.com"},
+		{HandlerConfig{Name: "d", Type: HandlerTypeSyslog, Message: "failed"}, "Send to syslog: failed"},
+		{HandlerConfig{Name: "e", Type: HandlerTypeSlack, Webhook: "https://hooks.slack.com/x"}, "Send to Slack: " + DefaultSlackMessage},
+		{HandlerConfig{Name: "f", Type: HandlerTypeNotify, URL: "ntfy://ntfy.sh/alerts"}, "Send to ntfy: https://ntfy.sh/alerts"},
+		{HandlerConfig{Name: "g", Type: HandlerTypeHTTP, URL: "https://example.com", Body: "{}"}, "Send HTTP request: POST https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.config.Type, func(t *testing.T) {
+			handler, err := tt.config.Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			if handler.Description() != tt.wantDesc {
+				t.Errorf("Description() = %q, want %q", handler.Description(), tt.wantDesc)
+			}
+			if _, ok := handler.(handlers.EventHandler); !ok {
+				t.Errorf("handler %T does not implement EventHandler", handler)
+			}
+		})
+	}
+}
+
+func TestHandlerConfigPhases(t *testing.T) {
+	hc := HandlerConfig{Name: "log", Type: HandlerTypeSyslog, Message: "x"}
+	if got := hc.Phases(); len(got) != 1 || got[0] != handlers.PhaseFailure {
+		t.Errorf("Phases() = %q, want [failure]", got)
+	}
+	hc.On = []string{handlers.PhaseStart, handlers.PhaseFinish}
+	if got := hc.Phases(); len(got) != 2 || got[1] != handlers.PhaseFinish {
+		t.Errorf("Phases() = %q, want [start finish]", got)
+	}
+}
+
+func TestHandlerConfigSecrets(t *testing.T) {
+	t.Setenv("FAILHOOK_TEST_NTFY", "ntfy://ntfy.sh/secret-topic")
+
+	// References are accepted by validation and resolved by Build
+	cfg, err := ParseConfig([]byte("handlers:\n  - {name: push, type: notify, url: 'env:FAILHOOK_TEST_NTFY'}\n"), ".yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	handler, err := cfg.Handlers[0].Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if handler.Description() != "Send to ntfy: https://ntfy.sh/secret-topic" {
+		t.Errorf("Description() = %q", handler.Description())
+	}
+	if cfg.Handlers[0].URL != "env:FAILHOOK_TEST_NTFY" {
+		t.Errorf("Build changed the configuration to %q", cfg.Handlers[0].URL)
+	}
+
+	hc := HandlerConfig{Name: "s", Type: HandlerTypeSlack, Webhook: "env:FAILHOOK_TEST_UNSET"}
+	if _, err := hc.Build(); err == nil || !strings.HasPrefix(err.Error(), "webhook: environment variable FAILHOOK_TEST_UNSET is not set") {
+		t.Errorf("Build() error = %v, want unset webhook variable", err)
+	}
+}
+
+func TestHandlerConfigBuildTimeout(t *testing.T) {
+	hc := HandlerConfig{Name: "slow", Type: HandlerTypeCommand, Command: "sleep 10", Timeout: "50ms"}
+	handler, err := hc.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	timeoutHandler, ok := handler.(*handlers.TimeoutHandler)
+	if !ok {
+		t.Fatalf("handler %T is not a *handlers.TimeoutHandler", handler)
+	}
+	if timeoutHandler.Timeout() != 50*time.Millisecond || handler.Description() != "Execute command: sleep 10" {
+		t.Errorf("Timeout(), Description() = %v, %q", timeoutHandler.Timeout(), handler.Description())
+	}
+	if err := handler.Handle(1, ""); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Handle() error = %v, want timed out", err)
+	}
+}
+
+func TestHandlerConfigBuildRetries(t *testing.T) {
+	retries := 4
+	hc := HandlerConfig{Name: "hook", Type: HandlerTypeWebhook, URL: "https://example.com", Timeout: "5s",
+		Retries: &retries, RetryDelay: "250ms", RetryMaxDelay: "10s"}
+	handler, err := hc.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	retryHandler, ok := handler.(*handlers.RetryHandler)
+	if !ok {
+		t.Fatalf("handler %T is not a *handlers.RetryHandler", handler)
+	}
+	policy := retryHandler.Policy()
+	if policy.Retries != 4 || policy.InitialDelay != 250*time.Millisecond || policy.MaxDelay != 10*time.Second {
+		t.Errorf("policy = %+v", policy)
+	}
+	if !handlers.HasTimeout(retryHandler) {
+		t.Error("the timeout was lost when adding retries")
+	}
+
+	hc = HandlerConfig{Name: "hook", Type: HandlerTypeWebhook, URL: "https://example.com", RetryDelay: "1s"}
+	if err := hc.Validate(); err == nil || err.Error() != "retry_delay: requires retries" {
+		t.Errorf("Validate() error = %v, want retry_delay: requires retries", err)
+	}
+}
+
+func TestHandlerConfigDefaultTimeout(t *testing.T) {
+	// Every attempt fails slowly until the third, taking longer than one
+	// timeout in total
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	retries := 2
+	hc := HandlerConfig{Name: "api", Type: HandlerTypeHTTP, URL: server.URL, Body: "{}", Retries: &retries, RetryDelay: "1ms"}
+	hc.ApplyDefaultTimeout(100 * time.Millisecond)
+	if hc.Timeout != "100ms" {
+		t.Errorf("Timeout = %q, want 100ms", hc.Timeout)
+	}
+	handler, err := hc.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	failhook := NewFailHook(false)
+	failhook.SetHandlerTimeouts(100*time.Millisecond, 0)
+	failhook.AddHandler(handler)
+	if err := failhook.HandleEvent(handlers.NewFailureEvent(1, "")); err != nil {
+		t.Errorf("HandleEvent failed after %d requests: %v", requests.Load(), err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("requests = %d, want 3", requests.Load())
+	}
+
+	// Handlers with a timeout of their own, or without retries, keep theirs
+	hc = HandlerConfig{Name: "api", Type: HandlerTypeHTTP, URL: server.URL, Timeout: "5s", Retries: &retries}
+	hc.ApplyDefaultTimeout(time.Second)
+	if hc.Timeout != "5s" {
+		t.Errorf("Timeout = %q, want 5s", hc.Timeout)
+	}
+	hc = HandlerConfig{Name: "api", Type: HandlerTypeHTTP, URL: server.URL}
+	hc.ApplyDefaultTimeout(time.Second)
+	if hc.Timeout != "" {
+		t.Errorf("Timeout = %q, want none", hc.Timeout)
+	}
+}
+
+func TestHandlerConfigRateLimitFile(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	hc := HandlerConfig{Name: "slack", Type: HandlerTypeSyslog, Message: "x", RateLimit: "1/h",
+		Fallback: &HandlerConfig{Type: HandlerTypeSyslog, Message: "y", RateLimit: "1/h"}}
+	hc.SetJob("backup")
+	backup, _ := hc.rateLimitFile()
+	if want := filepath.Join(cache, "failhook", "ratelimit", "backup", "slack.json"); backup != want {
+		t.Errorf("rateLimitFile() = %q, want %q", backup, want)
+	}
+	fallback := hc.fallbackConfig()
+	if file, _ := fallback.rateLimitFile(); file != filepath.Join(cache, "failhook", "ratelimit", "backup", "slack.fallback.json") {
+		t.Errorf("fallback rateLimitFile() = %q, want it in the job's directory", file)
+	}
+
+	// Another job with a handler of the same name has a budget of its own
+	hc.SetJob("mirror-sync")
+	if mirror, _ := hc.rateLimitFile(); mirror == backup {
+		t.Errorf("jobs share the rate limit file %q", mirror)
+	}
+}
+
+func TestHandlerConfigBuildMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "fallback.log")
+	data := `
+handlers:
+  - name: flaky
+    type: command
+    command: "exit 3"
+    filter:
+      exit_codes: [1, 2]
+      output: "(?i)error"
+    rate_limit: 2/1h
+    rate_limit_file: ` + filepath.Join(dir, "flaky.json") + `
+    fallback:
+      type: command
+      command: "echo __STATUS_CODE__ >> ` + marker + `"
+`
+	cfg, err := ParseConfig([]byte(data), ".yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	handler, err := cfg.Handlers[0].Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if _, ok := handler.(*handlers.FilterHandler); !ok {
+		t.Fatalf("handler %T is not a *handlers.FilterHandler", handler)
+	}
+
+	// Filtered out, then two runs falling back, then rate limited
+	for _, exitCode := range []int{3, 1, 2, 1} {
+		if err := handler.Handle(exitCode, "Error: disk full"); err != nil {
+			t.Errorf("Handle(%d) failed: %v", exitCode, err)
+		}
+	}
+	got, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatalf("fallback did not run: %v", err)
+	}
+	if string(got) != "1\n2\n" {
+		t.Errorf("fallback ran for %q, want exit codes 1 and 2", got)
+	}
+}
+
+func TestFilterConfigExitCodes(t *testing.T) {
+	configs := map[string]string{
+		".yaml": "handlers:\n  - {name: pager, type: syslog, message: x, filter: {exit_codes: [2, \"64-78\"], classes: [signal, timeout]}}\n",
+		".toml": "[[handlers]]\nname = \"pager\"\ntype = \"syslog\"\nmessage = \"x\"\n[handlers.filter]\nexit_codes = [2, \"64-78\"]\nclasses = [\"signal\", \"timeout\"]\n",
+		".json": `{"handlers": [{"name": "pager", "type": "syslog", "message": "x", "filter": {"exit_codes": "2,64-78", "classes": ["signal", "timeout"]}}]}`,
+	}
+	for ext, data := range configs {
+		cfg, err := ParseConfig([]byte(data), ext)
+		if err != nil {
+			t.Errorf("%s: ParseConfig failed: %v", ext, err)
+			continue
+		}
+		filter := cfg.Handlers[0].Filter.EventFilter()
+		for _, tt := range []struct {
+			event *handlers.FailureEvent
+			want  bool
+		}{
+			{&handlers.FailureEvent{ExitCode: 2}, true},
+			{&handlers.FailureEvent{ExitCode: 70}, true},
+			{&handlers.FailureEvent{ExitCode: 1}, false},
+			{&handlers.FailureEvent{ExitCode: 143, Signal: 15}, true},
+			{&handlers.FailureEvent{ExitCode: 124, TimedOut: true}, true},
+			{&handlers.FailureEvent{ExitCode: 130, Interrupted: true}, false},
+		} {
+			if got := filter(tt.event); got != tt.want {
+				t.Errorf("%s: filter(%+v) = %v, want %v", ext, tt.event, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHandlerConfigBuildHTTP(t *testing.T) {
+	var body, token, tag string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		token = r.Header.Get("Authorization")
+		tag = r.Header.Get("X-Tag")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	t.Setenv("FAILHOOK_TEST_TOKEN", "s3cret")
+	bodyFile := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"code": __STATUS_CODE__, "output": "__OUTPUT__"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hc := HandlerConfig{
+		Name:          "api",
+		Type:          HandlerTypeHTTP,
+		URL:           server.URL,
+		Headers:       map[string]string{"X-Tag": "exit-__STATUS_CODE__"},
+		BodyFile:      bodyFile,
+		BearerToken:   "env:FAILHOOK_TEST_TOKEN",
+		SuccessStatus: []int{202},
+	}
+	handler, err := hc.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if err := handler.Handle(3, `say "hi"`); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	if body != `{"code": 3, "output": "say \"hi\""}` {
+		t.Errorf("body = %s", body)
+	}
+	if token != "Bearer s3cret" || tag != "exit-3" {
+		t.Errorf("Authorization, X-Tag = %q, %q", token, tag)
+	}
+}
+
+func TestHandlerConfigBuildSigned(t *testing.T) {
+	signer := handlers.NewSigner("s3cret", handlers.WithSignatureFormat(handlers.SignatureFormatGitHub))
+
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = signer.VerifyRequest(r, body)
+	}))
+	defer server.Close()
+
+	t.Setenv("FAILHOOK_TEST_SIGNING", "s3cret")
+	hc := HandlerConfig{
+		Name:            "api",
+		Type:            HandlerTypeHTTP,
+		URL:             server.URL,
+		Body:            `{"code": __STATUS_CODE__}`,
+		SigningSecret:   "env:FAILHOOK_TEST_SIGNING",
+		SignatureFormat: handlers.SignatureFormatGitHub,
+	}
+	handler, err := hc.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if err := handler.Handle(1, ""); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if verifyErr != nil {
+		t.Errorf("receiver rejected the signature: %v", verifyErr)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// registeredHandler is a handler with the phase and ordering group it was
+// added to
+type registeredHandler struct {
+	handler handlers.EventHandler
+	phase   string
+	group   string
+}
+
+// HandlerResult is the outcome of running one handler
+type HandlerResult struct {
+	Description string
+	Group       string
+	// Err is nil if the handler succeeded
+	Err error
+	// Skipped is set if the handler was not started because ctx was done
+	Skipped  bool
+	Duration time.Duration
+}
+
+// HandlerResults holds the results of all handlers in the order they were
+// added
+type HandlerResults []HandlerResult
+
+// Err joins the errors of all handlers that failed or were skipped, or
+// returns nil if they all succeeded
+func (r HandlerResults) Err() error {
+	var errs []error
+	for _, result := range r {
+		switch {
+		case result.Skipped:
+			errs = append(errs, fmt.Errorf("%s: not run: %w", result.Description, result.Err))
+		case result.Err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", result.Description, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String summarizes the results, e.g. "3 succeeded, 1 failed, 0 not run"
+func (r HandlerResults) String() string {
+	var succeeded, failed, skipped int
+	for _, result := range r {
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Err != nil:
+			failed++
+		default:
+			succeeded++
+		}
+	}
+	return fmt.Sprintf("%d succeeded, %d failed, %d not run", succeeded, failed, skipped)
+}
+
+// HasHandlers reports whether any handler is registered for phase
+func (fh *FailHook) HasHandlers(phase string) bool {
+	for _, registered := range fh.handlers {
+		if registered.phase == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// RunHandlers runs every handler registered for the phase of the event and
+// returns their results once all have completed. Events without a phase go
+// to the failure handlers. Up to the configured parallelism handlers run at
+// once; handlers of the same ordering group run one after another. Groups
+// start in the order of their first handler, so a parallelism of 1 runs
+// ungrouped handlers in the order they were added.
+func (fh *FailHook) RunHandlers(ctx context.Context, event *handlers.FailureEvent) HandlerResults {
+	phase := event.Phase
+	if phase == "" {
+		phase = handlers.PhaseFailure
+	}
+	var selected []registeredHandler
+	for _, registered := range fh.handlers {
+		if registered.phase == phase {
+			selected = append(selected, registered)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	if fh.totalHandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fh.totalHandlerTimeout)
+		defer cancel()
+	}
+
+	// Each unit is a list of handler indexes that run in sequence
+	var units [][]int
+	groupUnit := make(map[string]int)
+	for i, registered := range selected {
+		if registered.group == "" {
+			units = append(units, []int{i})
+			continue
+		}
+		if u, ok := groupUnit[registered.group]; ok {
+			units[u] = append(units[u], i)
+			continue
+		}
+		groupUnit[registered.group] = len(units)
+		units = append(units, []int{i})
+	}
+
+	workers := fh.parallelism
+	if workers <= 0 || workers > len(units) {
+		workers = len(units)
+	}
+
+	queue := make(chan []int, len(units))
+	for _, unit := range units {
+		queue <- unit
+	}
+	close(queue)
+
+	start := time.Now()
+	results := make(HandlerResults, len(selected))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unit := range queue {
+				for _, i := range unit {
+					results[i] = fh.runHandler(ctx, selected[i], event, &mu)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fh.debug {
+		fmt.Printf("%s handlers finished in %v: %s\n", phase, time.Since(start).Round(time.Millisecond), results)
+	}
+	return results
+}
+
+// runHandler runs one handler with the default timeout and retries applied.
+// mu serializes the messages printed about it.
+func (fh *FailHook) runHandler(ctx context.Context, registered registeredHandler, event *handlers.FailureEvent, mu *sync.Mutex) HandlerResult {
+	eventHandler := registered.handler
+	result := HandlerResult{Description: eventHandler.Description(), Group: registered.group}
+
+	// Apply the defaults to handlers without a timeout or retries of their
+	// own; the timeout limits each attempt
+	if fh.handlerTimeout > 0 && !handlers.HasTimeout(eventHandler) {
+		eventHandler = handlers.WithTimeout(eventHandler, fh.handlerTimeout)
+	}
+	if fh.retryPolicy.Retries > 0 && !handlers.HasRetry(eventHandler) {
+		eventHandler = handlers.WithRetry(eventHandler, fh.retryPolicy)
+	}
+	handler := handlers.AdaptContext(eventHandler)
+
+	if err := ctx.Err(); err != nil {
+		result.Skipped, result.Err = true, err
+		mu.Lock()
+		fmt.Fprintf(os.Stderr, "Skipping handler %s: %v\n", result.Description, err)
+		mu.Unlock()
+		return result
+	}
+
+	if fh.debug {
+		mu.Lock()
+		fmt.Printf("Executing handler: %s\n", result.Description)
+		mu.Unlock()
+	}
+	start := time.Now()
+	result.Err = handler.HandleEventContext(ctx, event)
+	result.Duration = time.Since(start)
+
+	if result.Err != nil {
+		mu.Lock()
+		fmt.Fprintf(os.Stderr, "Error with handler %s: %v\n", result.Description, result.Err)
+		mu.Unlock()
+	}
+	return result
+}
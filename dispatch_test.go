@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// trackingHandler records when it ran and how many handlers ran with it
+type trackingHandler struct {
+	name    string
+	delay   time.Duration
+	err     error
+	tracker *concurrencyTracker
+}
+
+// HandleEvent implements the handlers.EventHandler interface
+func (h *trackingHandler) HandleEvent(event *handlers.FailureEvent) error {
+	h.tracker.enter(h.name)
+	time.Sleep(h.delay)
+	h.tracker.leave()
+	return h.err
+}
+
+// Description implements the handlers.EventHandler interface
+func (h *trackingHandler) Description() string {
+	return h.name
+}
+
+// concurrencyTracker records the start order and the peak number of
+// handlers running at once
+type concurrencyTracker struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	order   []string
+}
+
+func (c *concurrencyTracker) enter(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running++
+	if c.running > c.peak {
+		c.peak = c.running
+	}
+	c.order = append(c.order, name)
+}
+
+func (c *concurrencyTracker) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+}
+
+func TestRunHandlersConcurrently(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	failhook.SetParallelism(0)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		failhook.AddEventHandler(&trackingHandler{name: name, delay: 100 * time.Millisecond, tracker: tracker})
+	}
+
+	start := time.Now()
+	results := failhook.RunHandlers(context.Background(), handlers.NewFailureEvent(1, ""))
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("handlers took %v, want them to run at the same time", elapsed)
+	}
+	if tracker.peak != 4 {
+		t.Errorf("peak concurrency = %d, want 4", tracker.peak)
+	}
+	if results.Err() != nil || results.String() != "4 succeeded, 0 failed, 0 not run" {
+		t.Errorf("results = %v, %v", results, results.Err())
+	}
+}
+
+func TestRunHandlersParallelismLimit(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	failhook.SetParallelism(2)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		failhook.AddEventHandler(&trackingHandler{name: name, delay: 30 * time.Millisecond, tracker: tracker})
+	}
+
+	failhook.RunHandlers(context.Background(), handlers.NewFailureEvent(1, ""))
+	if tracker.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", tracker.peak)
+	}
+}
+
+func TestRunHandlersSequentialByDefault(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	for _, name := range []string{"a", "b", "c"} {
+		failhook.AddEventHandler(&trackingHandler{name: name, tracker: tracker})
+	}
+
+	failhook.RunHandlers(context.Background(), handlers.NewFailureEvent(1, ""))
+	if tracker.peak != 1 || strings.Join(tracker.order, "") != "abc" {
+		t.Errorf("peak, order = %d, %v, want 1, [a b c]", tracker.peak, tracker.order)
+	}
+}
+
+func TestRunHandlersGroups(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	failhook.SetParallelism(0)
+	failhook.AddEventHandlerToGroup("report", &trackingHandler{name: "collect", delay: 50 * time.Millisecond, tracker: tracker})
+	failhook.AddEventHandler(&trackingHandler{name: "slack", delay: 50 * time.Millisecond, tracker: tracker})
+	failhook.AddEventHandlerToGroup("report", &trackingHandler{name: "upload", delay: 50 * time.Millisecond, tracker: tracker})
+
+	results := failhook.RunHandlers(context.Background(), handlers.NewFailureEvent(1, ""))
+
+	// collect and slack start together; upload waits for collect
+	if tracker.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", tracker.peak)
+	}
+	if tracker.order[len(tracker.order)-1] != "upload" {
+		t.Errorf("order = %v, want upload last", tracker.order)
+	}
+	if results[0].Group != "report" || results[1].Group != "" || results[2].Description != "upload" {
+		t.Errorf("results are not in the order the handlers were added: %+v", results)
+	}
+}
+
+func TestRunHandlersPhases(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	failhook.AddHook(handlers.PhaseStart, "", &trackingHandler{name: "start", tracker: tracker})
+	failhook.AddEventHandler(&trackingHandler{name: "failure", tracker: tracker})
+	failhook.AddHook(handlers.PhaseSuccess, "", &trackingHandler{name: "success", tracker: tracker})
+	failhook.AddHook(handlers.PhaseFinish, "", &trackingHandler{name: "finish", tracker: tracker})
+
+	for _, phase := range []string{handlers.PhaseStart, handlers.PhaseFailure, handlers.PhaseFinish} {
+		event := handlers.NewFailureEvent(1, "")
+		event.Phase = phase
+		if results := failhook.RunHandlers(context.Background(), event); len(results) != 1 {
+			t.Errorf("phase %s ran %d handlers, want 1", phase, len(results))
+		}
+	}
+	if got := strings.Join(tracker.order, ","); got != "start,failure,finish" {
+		t.Errorf("order = %s, want start,failure,finish", got)
+	}
+
+	// Phases without handlers run nothing
+	event := handlers.NewFailureEvent(0, "")
+	event.Phase = handlers.PhaseSuccess
+	failhook = NewFailHook(false)
+	failhook.AddEventHandler(&trackingHandler{name: "failure", tracker: tracker})
+	if failhook.HasHandlers(handlers.PhaseStart) || !failhook.HasHandlers(handlers.PhaseFailure) {
+		t.Error("HasHandlers() does not match the phases handlers were added to")
+	}
+	if results := failhook.RunHandlers(context.Background(), event); results != nil {
+		t.Errorf("results = %+v, want nil", results)
+	}
+}
+
+func TestHandlerResults(t *testing.T) {
+	tracker := &concurrencyTracker{}
+	failhook := NewFailHook(false)
+	failhook.SetParallelism(0)
+	failhook.AddEventHandler(&trackingHandler{name: "ok", tracker: tracker})
+	failhook.AddEventHandler(&trackingHandler{name: "broken", err: errors.New("boom"), tracker: tracker})
+
+	results := failhook.RunHandlers(context.Background(), handlers.NewFailureEvent(1, ""))
+	if results.String() != "1 succeeded, 1 failed, 0 not run" {
+		t.Errorf("String() = %q", results.String())
+	}
+	if err := results.Err(); err == nil || err.Error() != "broken: boom" {
+		t.Errorf("Err() = %v, want broken: boom", err)
+	}
+	if results[1].Err == nil || results[0].Err != nil {
+		t.Errorf("results = %+v", results)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// EnvPrefix is the prefix of the environment variables that set options
+const EnvPrefix = "FAILHOOK_"
+
+// EnvName returns the environment variable that sets a flag, e.g.
+// FAILHOOK_SLACK_WEBHOOK for -slack-webhook
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// repeatableFlag is implemented by flag values that may be given more than
+// once
+type repeatableFlag interface {
+	IsRepeatable() bool
+}
+
+// defaultFlag is implemented by flag values whose environment variable sets a
+// default for every occurrence rather than a single occurrence
+type defaultFlag interface {
+	SetDefault(value string) error
+}
+
+// ApplyEnv sets every flag in fs that was not given on the command line from
+// its FAILHOOK_* environment variable, so command line flags take precedence.
+// Repeatable flags also read numbered variables (FAILHOOK_W_1, FAILHOOK_W_2,
+// ...) up to the first one that is missing. Empty variables and the
+// FAILHOOK_EVENT_* variables that describe an event to command hooks are
+// ignored.
+func ApplyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || f.Name == "h" {
+			return
+		}
+
+		// Variables describing an event are passed to command hooks and
+		// never set options
+		name := EnvName(f.Name)
+		if strings.HasPrefix(name, handlers.EventEnvPrefix) {
+			return
+		}
+		names := []string{name}
+		if r, ok := f.Value.(repeatableFlag); ok && r.IsRepeatable() {
+			for i := 1; ; i++ {
+				numbered := name + "_" + strconv.Itoa(i)
+				if _, ok := lookup(numbered); !ok {
+					break
+				}
+				names = append(names, numbered)
+			}
+		}
+
+		for _, name := range names {
+			value, ok := lookup(name)
+			if !ok || value == "" {
+				continue
+			}
+			set := func(value string) error { return fs.Set(f.Name, value) }
+			if d, ok := f.Value.(defaultFlag); ok {
+				set = d.SetDefault
+			}
+			if setErr := set(value); setErr != nil {
+				err = fmt.Errorf("%s: %v", name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// envRefName matches the variable name of an env: reference
+var envRefName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isSecretRef reports whether value is an env:NAME or file:PATH reference
+func isSecretRef(value string) bool {
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		return envRefName.MatchString(name)
+	}
+	if path, ok := strings.CutPrefix(value, "file:"); ok {
+		return path != ""
+	}
+	return false
+}
+
+// ResolveSecret returns the value an env:NAME or file:PATH reference points
+// to: the environment variable, or the file contents without trailing line
+// breaks. Other values are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return resolved, nil
+	}
+
+	path := strings.TrimPrefix(value, "file:")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
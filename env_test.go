@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"timeout":       "FAILHOOK_TIMEOUT",
+		"slack-webhook": "FAILHOOK_SLACK_WEBHOOK",
+		"c-stdin":       "FAILHOOK_C_STDIN",
+		"d":             "FAILHOOK_D",
+	}
+	for flagName, want := range tests {
+		if got := EnvName(flagName); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", flagName, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	var (
+		timeout  int
+		policy   string
+		debug    bool
+		webhooks stringList
+		slack    slackFlags
+	)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&timeout, "timeout", 0, "")
+	fs.StringVar(&policy, "exit-policy", ExitPolicyChild, "")
+	fs.BoolVar(&debug, "d", false, "")
+	fs.Var(&webhooks, "w", "")
+	fs.Var(slack.Webhook(), "slack-webhook", "")
+	fs.Var(slack.Channel(), "slack-channel", "")
+
+	if err := fs.Parse([]string{"-exit-policy", "zero", "-slack-webhook", "https://hooks.slack.com/cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"FAILHOOK_TIMEOUT":       "30",
+		"FAILHOOK_EXIT_POLICY":   "handler",
+		"FAILHOOK_D":             "",
+		"FAILHOOK_W":             "https://example.com/a",
+		"FAILHOOK_W_1":           "https://example.com/b",
+		"FAILHOOK_W_2":           "https://example.com/c",
+		"FAILHOOK_W_4":           "https://example.com/skipped",
+		"FAILHOOK_SLACK_WEBHOOK": "https://hooks.slack.com/env",
+		"FAILHOOK_SLACK_CHANNEL": "#ops",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := ApplyEnv(fs, lookup); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+
+	if timeout != 30 {
+		t.Errorf("timeout = %d, want 30", timeout)
+	}
+	if policy != "zero" {
+		t.Errorf("exit-policy = %q, want the flag value zero", policy)
+	}
+	if debug {
+		t.Error("debug = true, want empty variable to be ignored")
+	}
+	if got := strings.Join(webhooks, " "); got != "https://example.com/a https://example.com/b https://example.com/c" {
+		t.Errorf("webhooks = %q", got)
+	}
+
+	configs := slack.Configs()
+	if len(configs) != 1 || configs[0].Webhook != "https://hooks.slack.com/cli" {
+		t.Fatalf("slack configs = %+v, want only the command line webhook", configs)
+	}
+	if configs[0].Channel != "#ops" {
+		t.Errorf("channel = %q, want the environment default #ops", configs[0].Channel)
+	}
+}
+
+func TestApplyEnvError(t *testing.T) {
+	var timeout int
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&timeout, "timeout", 0, "")
+
+	err := ApplyEnv(fs, func(name string) (string, bool) {
+		return "soon", name == "FAILHOOK_TIMEOUT"
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "FAILHOOK_TIMEOUT:") {
+		t.Errorf("ApplyEnv() error = %v, want it to name FAILHOOK_TIMEOUT", err)
+	}
+}
+
+func TestApplyEnvIgnoresEventEnv(t *testing.T) {
+	// A failhook run from a command hook inherits the event variables of the
+	// run that called it
+	env, cleanup, err := handlers.EventEnv(&handlers.FailureEvent{Job: "parent", ExitCode: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	values := make(map[string]string)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("job", "", "")
+	for _, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		values[name] = value
+		// Even a flag named like an event variable is not set from it
+		flagName := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, EnvPrefix), "_", "-"))
+		if EnvName(flagName) != name {
+			t.Fatalf("EnvName(%q) = %q, want %q", flagName, EnvName(flagName), name)
+		}
+		fs.String(flagName, "", "")
+	}
+
+	err = ApplyEnv(fs, func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != "" {
+			t.Errorf("-%s = %q, want event variables to be ignored", f.Name, f.Value)
+		}
+	})
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("FAILHOOK_TEST_SECRET", "https://hooks.slack.com/secret")
+	path := filepath.Join(t.TempDir(), "slack")
+	if err := os.WriteFile(path, []byte("https://hooks.slack.com/from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"env:FAILHOOK_TEST_SECRET", "https://hooks.slack.com/secret"},
+		{"file:" + path, "https://hooks.slack.com/from-file"},
+		{"https://example.com", "https://example.com"},
+		{"env:not a name", "env:not a name"},
+		{"file:", "file:"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveSecret(tt.value)
+		if err != nil {
+			t.Errorf("ResolveSecret(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := ResolveSecret("env:FAILHOOK_TEST_UNSET"); err == nil || !strings.Contains(err.Error(), "not set") {
+		t.Errorf("unset variable error = %v, want not set", err)
+	}
+	if _, err := ResolveSecret("file:" + filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file error = nil")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Set implements flag.Value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// IsRepeatable implements repeatableFlag
+func (l *stringList) IsRepeatable() bool {
+	return true
+}
+
+// slackFlags collects the repeatable Slack flags. Every -slack-webhook starts
+// a new Slack handler; -slack-msg, -slack-channel and -slack-username apply
+// to the most recent -slack-webhook, or to all Slack handlers if they are
+// given before the first one.
+type slackFlags struct {
+	defaults HandlerConfig
+	configs  []HandlerConfig
+}
+
+// current returns the handler configuration the next Slack option applies to
+func (sf *slackFlags) current() *HandlerConfig {
+	if len(sf.configs) == 0 {
+		return &sf.defaults
+	}
+	return &sf.configs[len(sf.configs)-1]
+}
+
+// Webhook returns the flag.Value for -slack-webhook
+func (sf *slackFlags) Webhook() flag.Value {
+	return slackFlag{sf, func(hc *HandlerConfig) *string { return &hc.Webhook }, true}
+}
+
+// Message returns the flag.Value for -slack-msg
+func (sf *slackFlags) Message() flag.Value {
+	return slackFlag{sf, func(hc *HandlerConfig) *string { return &hc.Message }, false}
+}
+
+// Channel returns the flag.Value for -slack-channel
+func (sf *slackFlags) Channel() flag.Value {
+	return slackFlag{sf, func(hc *HandlerConfig) *string { return &hc.Channel }, false}
+}
+
+// Username returns the flag.Value for -slack-username
+func (sf *slackFlags) Username() flag.Value {
+	return slackFlag{sf, func(hc *HandlerConfig) *string { return &hc.Username }, false}
+}
+
+// Configs returns one handler configuration per -slack-webhook, with options
+// not given for a webhook taken from the defaults
+func (sf *slackFlags) Configs() []HandlerConfig {
+	configs := make([]HandlerConfig, len(sf.configs))
+	for i, hc := range sf.configs {
+		hc.Name = fmt.Sprintf("-slack-webhook[%d]", i)
+		hc.Type = HandlerTypeSlack
+		if hc.Message == "" {
+			hc.Message = sf.defaults.Message
+		}
+		if hc.Message == "" {
+			hc.Message = DefaultSlackMessage
+		}
+		if hc.Channel == "" {
+			hc.Channel = sf.defaults.Channel
+		}
+		if hc.Username == "" {
+			hc.Username = sf.defaults.Username
+		}
+		configs[i] = hc
+	}
+	return configs
+}
+
+// slackFlag is a flag.Value setting one field of a Slack handler configuration
+type slackFlag struct {
+	flags *slackFlags
+	field func(*HandlerConfig) *string
+	// starts is set for the flag that starts a new handler
+	starts bool
+}
+
+// String implements flag.Value
+func (f slackFlag) String() string {
+	if f.flags == nil {
+		return ""
+	}
+	return *f.field(f.flags.current())
+}
+
+// Set implements flag.Value
+func (f slackFlag) Set(value string) error {
+	if f.starts {
+		f.flags.configs = append(f.flags.configs, HandlerConfig{})
+	}
+	*f.field(f.flags.current()) = value
+	return nil
+}
+
+// IsRepeatable implements repeatableFlag; only -slack-webhook is repeatable
+// on its own
+func (f slackFlag) IsRepeatable() bool {
+	return f.starts
+}
+
+// SetDefault implements defaultFlag. -slack-webhook adds a handler; the other
+// Slack options set the default for every Slack handler.
+func (f slackFlag) SetDefault(value string) error {
+	if f.starts {
+		return f.Set(value)
+	}
+	*f.field(&f.flags.defaults) = value
+	return nil
+}
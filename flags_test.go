@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestStringList(t *testing.T) {
+	var list stringList
+	fs := flag.NewFlagSet("failhook", flag.ContinueOnError)
+	fs.Var(&list, "w", "")
+
+	if err := fs.Parse([]string{"-w", "https://a.example.com", "-w", "https://b.example.com"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(list) != 2 || list[0] != "https://a.example.com" || list[1] != "https://b.example.com" {
+		t.Errorf("list = %q, want both URLs in order", list)
+	}
+}
+
+func TestSlackFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []HandlerConfig
+	}{
+		{
+			name: "single webhook with options before it",
+			args: []string{"-slack-msg", "failed", "-slack-webhook", "https://a"},
+			want: []HandlerConfig{
+				{Webhook: "https://a", Message: "failed"},
+			},
+		},
+		{
+			name: "single webhook with default message",
+			args: []string{"-slack-webhook", "https://a"},
+			want: []HandlerConfig{
+				{Webhook: "https://a", Message: DefaultSlackMessage},
+			},
+		},
+		{
+			name: "options pair with the preceding webhook",
+			args: []string{
+				"-slack-channel", "#all",
+				"-slack-webhook", "https://a", "-slack-msg", "to a",
+				"-slack-webhook", "https://b", "-slack-channel", "#b", "-slack-username", "bot",
+			},
+			want: []HandlerConfig{
+				{Webhook: "https://a", Message: "to a", Channel: "#all"},
+				{Webhook: "https://b", Message: DefaultSlackMessage, Channel: "#b", Username: "bot"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slack slackFlags
+			fs := flag.NewFlagSet("failhook", flag.ContinueOnError)
+			fs.Var(slack.Webhook(), "slack-webhook", "")
+			fs.Var(slack.Message(), "slack-msg", "")
+			fs.Var(slack.Channel(), "slack-channel", "")
+			fs.Var(slack.Username(), "slack-username", "")
+
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			configs := slack.Configs()
+			if len(configs) != len(tt.want) {
+				t.Fatalf("config count = %d, want %d", len(configs), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := configs[i]
+				if got.Type != HandlerTypeSlack || got.Name == "" {
+					t.Errorf("config %d type, name = %q, %q", i, got.Type, got.Name)
+				}
+				if got.Webhook != want.Webhook || got.Message != want.Message ||
+					got.Channel != want.Channel || got.Username != want.Username {
+					t.Errorf("config %d = %+v, want %+v", i, got, want)
+				}
+				if _, err := got.Build(); err != nil {
+					t.Errorf("config %d Build failed: %v", i, err)
+				}
+			}
+		})
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/zishida/failhook
 
-go 1.21
\ No newline at end of file
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CommandHandler executes a command on failure.
+//
+// The failure event is always exported to the command as FAILHOOK_EVENT_*
+// environment variables, with the captured output in temporary files named by
+// FAILHOOK_EVENT_OUTPUT_FILE, FAILHOOK_EVENT_STDOUT_FILE and
+// FAILHOOK_EVENT_STDERR_FILE, so the command never has to splice output into
+// its own command line.
+type CommandHandler struct {
+	// command is run by sh -c; placeholders refer to environment variables
+	// holding their values
+	command string
+	// argv is run directly without a shell when set
+	argv       []string
+	eventStdin bool
+	registry   *PlaceholderRegistry
+}
+
+// NewCommandHandler creates a new CommandHandler running command with sh -c.
+// Placeholders are replaced with references to environment variables holding
+// their values, so the shell never parses __OUTPUT__ however it is quoted; use
+// the raw filter to opt out.
+func NewCommandHandler(command string, options ...func(*CommandHandler)) *CommandHandler {
+	handler := &CommandHandler{
+		command:  command,
+		registry: NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// NewExecHandler creates a new CommandHandler running argv directly, without a
+// shell. Placeholders in each argument are replaced without escaping.
+func NewExecHandler(argv []string, options ...func(*CommandHandler)) *CommandHandler {
+	handler := &CommandHandler{
+		argv:     argv,
+		registry: NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithEventStdin writes the failure event as JSON to the command's stdin
+func WithEventStdin() func(*CommandHandler) {
+	return func(h *CommandHandler) {
+		h.eventStdin = true
+	}
+}
+
+// Handle executes the command with placeholders replaced
+func (h *CommandHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent executes the command with placeholders replaced and the event
+// exported to its environment
+func (h *CommandHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext executes the command with placeholders replaced and the event
+// exported to its environment, giving up when ctx is done
+func (h *CommandHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	var cmd *exec.Cmd
+	var values []string
+	if h.argv != nil {
+		if len(h.argv) == 0 {
+			return fmt.Errorf("empty command")
+		}
+		args := make([]string, len(h.argv))
+		for i, arg := range h.argv {
+			args[i] = h.registry.ReplaceEvent(arg, event)
+		}
+		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	} else {
+		var command string
+		command, values = h.registry.ReplaceEventShell(h.command, event)
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	env, cleanup, err := EventEnv(event)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	cmd.Env = append(append(os.Environ(), env...), values...)
+
+	if h.eventStdin {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return Permanent(fmt.Errorf("error marshaling event: %v", err))
+		}
+		cmd.Stdin = bytes.NewReader(payload)
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// On cancellation kill the whole process group, so commands started by
+	// the shell do not outlive the handler
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	return cmd.Run()
+}
+
+// Description returns a description of the handler
+func (h *CommandHandler) Description() string {
+	if h.argv != nil {
+		return fmt.Sprintf("Execute command: %s", strings.Join(h.argv, " "))
+	}
+	return fmt.Sprintf("Execute command: %s", h.command)
+}
+
+// EventEnvPrefix is the prefix of the environment variables describing an
+// event. It keeps them apart from the FAILHOOK_* variables that set options,
+// so a failhook run from a command hook does not take on the options of the
+// run that called it.
+const EventEnvPrefix = "FAILHOOK_EVENT_"
+
+// EventEnv returns the FAILHOOK_EVENT_* environment variables describing
+// event. The captured output is written to temporary files named by the
+// variables; the returned cleanup function removes them.
+func EventEnv(event *FailureEvent) ([]string, func(), error) {
+	var files []string
+	cleanup := func() {
+		for _, name := range files {
+			os.Remove(name)
+		}
+	}
+
+	writeTemp := func(pattern, content string) (string, error) {
+		f, err := os.CreateTemp("", pattern)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, f.Name())
+		if _, err := f.WriteString(content); err != nil {
+			f.Close()
+			return "", err
+		}
+		return f.Name(), f.Close()
+	}
+
+	env := []string{
+		EventEnvPrefix + "VERSION=" + strconv.Itoa(event.Version),
+		EventEnvPrefix + "RUN_ID=" + event.RunID,
+		EventEnvPrefix + "PHASE=" + event.Phase,
+		EventEnvPrefix + "OUTCOME=" + event.Outcome,
+		EventEnvPrefix + "EXIT_CODE=" + strconv.Itoa(event.ExitCode),
+		EventEnvPrefix + "SIGNAL=" + strconv.Itoa(event.Signal),
+		EventEnvPrefix + "TIMED_OUT=" + strconv.FormatBool(event.TimedOut),
+		EventEnvPrefix + "INTERRUPTED=" + strconv.FormatBool(event.Interrupted),
+		EventEnvPrefix + "COMMAND=" + event.Command,
+		EventEnvPrefix + "COMMAND_NAME=" + event.CommandName,
+		EventEnvPrefix + "PID=" + strconv.Itoa(event.PID),
+		EventEnvPrefix + "CWD=" + event.WorkingDir,
+		EventEnvPrefix + "USER=" + event.User,
+		EventEnvPrefix + "HOSTNAME=" + event.Hostname,
+		EventEnvPrefix + "START_TIME=" + formatEventTime(event.StartTime),
+		EventEnvPrefix + "END_TIME=" + formatEventTime(event.EndTime),
+		EventEnvPrefix + "DURATION_SECONDS=" + strconv.FormatFloat(event.Duration.Seconds(), 'f', 3, 64),
+		EventEnvPrefix + "ATTEMPTS=" + strconv.Itoa(event.AttemptCount()),
+		EventEnvPrefix + "ATTEMPT_EXIT_CODES=" + joinInts(event.AttemptExitCodes()),
+		EventEnvPrefix + "MATCH=" + event.Match,
+		EventEnvPrefix + "JOB=" + event.Job,
+		EventEnvPrefix + "PREVIOUS_OUTCOME=" + event.PreviousOutcome,
+		EventEnvPrefix + "CONSECUTIVE_FAILURES=" + strconv.Itoa(event.ConsecutiveFailures),
+		EventEnvPrefix + "FAILING_SINCE=" + formatEventTime(event.FailingSince),
+	}
+
+	for _, output := range []struct {
+		name    string
+		content string
+	}{
+		{"OUTPUT", event.Output},
+		{"STDOUT", event.Stdout},
+		{"STDERR", event.Stderr},
+	} {
+		name, err := writeTemp("failhook-"+strings.ToLower(output.name)+"-*", output.content)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("error writing %s file: %v", strings.ToLower(output.name), err)
+		}
+		env = append(env, EventEnvPrefix+output.name+"_FILE="+name)
+	}
+
+	return env, cleanup, nil
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandHandler(t *testing.T) {
+	// Create a temporary file to store command output
+	tmpFile, err := os.CreateTemp("", "command_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+
+	// Test command that writes output to the temp file
+	handler := NewCommandHandler(fmt.Sprintf("echo 'Exit code: __STATUS_CODE__, Output: __OUTPUT__' > %s", tmpFile.Name()))
+
+	// Execute the handler
+	exitCode := 42
+	output := "test output"
+	err = handler.Handle(exitCode, output)
+	if err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	// Verify the command was executed correctly
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+
+	expectedContent := fmt.Sprintf("Exit code: %d, Output: %s\n", exitCode, output)
+	if string(content) != expectedContent {
+		t.Errorf("handler output = %q, want %q", string(content), expectedContent)
+	}
+
+	// Test description
+	desc := handler.Description()
+	if !strings.Contains(desc, "Execute command") {
+		t.Errorf("Description %q does not contain 'Execute command'", desc)
+	}
+}
+
+func TestCommandHandlerEvent(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "command_test")
+
+	handler := NewCommandHandler(fmt.Sprintf("echo '__STDERR__' > %s", tmpFile))
+	err := handler.HandleEvent(&FailureEvent{
+		ExitCode: 1,
+		Output:   "out\nerr",
+		Stdout:   "out\n",
+		Stderr:   "err\n",
+	})
+	if err != nil {
+		t.Fatalf("Handler.HandleEvent failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	if string(content) != "err\n" {
+		t.Errorf("handler output = %q, want %q", string(content), "err\n")
+	}
+}
+
+func TestCommandHandlerShellQuoting(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "command_test")
+	marker := filepath.Join(t.TempDir(), "injected")
+
+	// Output trying to break out of the quoting must not be executed
+	output := fmt.Sprintf("'; touch %s; echo '$(touch %s)\"`touch %s`", marker, marker, marker)
+	handler := NewCommandHandler(fmt.Sprintf(
+		`echo __OUTPUT__ > %s; echo 'single: __OUTPUT__' >> %s; echo "double: __OUTPUT__" >> %s`, tmpFile, tmpFile, tmpFile))
+	if err := handler.Handle(1, output); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("command output was executed by the shell")
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	want := output + "\nsingle: " + output + "\ndouble: " + output + "\n"
+	if string(content) != want {
+		t.Errorf("handler output = %q, want %q", string(content), want)
+	}
+}
+
+func TestCommandHandlerCommandSubstitution(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "command_test")
+
+	// Values inside $(...) and backticks are not parsed by the shell either
+	output := "x'; echo PWNED; '"
+	handler := NewCommandHandler(fmt.Sprintf(
+		"echo \"$(echo '__OUTPUT__')\" > %s; echo `echo \"__OUTPUT__\"` >> %s", tmpFile, tmpFile))
+	if err := handler.Handle(1, output); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	if want := output + "\n" + output + "\n"; string(content) != want {
+		t.Errorf("handler output = %q, want %q", string(content), want)
+	}
+}
+
+func TestCommandHandlerEnv(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "command_test")
+
+	handler := NewCommandHandler(fmt.Sprintf(
+		`{ echo "$FAILHOOK_EVENT_EXIT_CODE $FAILHOOK_EVENT_HOSTNAME $FAILHOOK_EVENT_TIMED_OUT"; cat "$FAILHOOK_EVENT_STDERR_FILE"; } > %s`, tmpFile))
+	err := handler.HandleEvent(&FailureEvent{
+		Version:  EventVersion,
+		ExitCode: 124,
+		Hostname: "web1",
+		TimedOut: true,
+		Stderr:   "it's $(not) run\n",
+	})
+	if err != nil {
+		t.Fatalf("Handler.HandleEvent failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	want := "124 web1 true\nit's $(not) run\n"
+	if string(content) != want {
+		t.Errorf("handler output = %q, want %q", string(content), want)
+	}
+}
+
+func TestEventEnvCleanup(t *testing.T) {
+	env, cleanup, err := EventEnv(&FailureEvent{Output: "output"})
+	if err != nil {
+		t.Fatalf("EventEnv failed: %v", err)
+	}
+
+	var outputFile string
+	for _, v := range env {
+		if strings.HasPrefix(v, "FAILHOOK_EVENT_OUTPUT_FILE=") {
+			outputFile = strings.TrimPrefix(v, "FAILHOOK_EVENT_OUTPUT_FILE=")
+		}
+	}
+	content, err := os.ReadFile(outputFile)
+	if err != nil || string(content) != "output" {
+		t.Fatalf("output file content = %q, %v, want %q", content, err, "output")
+	}
+
+	cleanup()
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Errorf("output file %s not removed", outputFile)
+	}
+}
+
+func TestEventEnvDoesNotResolveFQDN(t *testing.T) {
+	_, cleanup, err := EventEnv(&FailureEvent{Hostname: "failhook-env-test"})
+	if err != nil {
+		t.Fatalf("EventEnv failed: %v", err)
+	}
+	cleanup()
+
+	fqdnMu.Lock()
+	_, resolved := fqdnCache["failhook-env-test"]
+	fqdnMu.Unlock()
+	if resolved {
+		t.Error("EventEnv looked up the FQDN")
+	}
+}
+
+func TestCommandHandlerEventStdin(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "command_test")
+
+	handler := NewCommandHandler(fmt.Sprintf("cat > %s", tmpFile), WithEventStdin())
+	event := &FailureEvent{
+		Version:   EventVersion,
+		ExitCode:  3,
+		Output:    "failed",
+		StartTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := handler.HandleEvent(event); err != nil {
+		t.Fatalf("Handler.HandleEvent failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	var received FailureEvent
+	if err := json.Unmarshal(content, &received); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if received.ExitCode != 3 || received.Output != "failed" || !received.StartTime.Equal(event.StartTime) {
+		t.Errorf("received event = %+v, want %+v", received, event)
+	}
+}
+
+func TestExecHandler(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "exec_test")
+
+	// Arguments are passed without a shell, so no quoting is involved
+	handler := NewExecHandler([]string{"sh", "-c", `printf '%s|%s' "$1" "$2" > "$3"`, "sh", "__STATUS_CODE__", "__OUTPUT__", tmpFile})
+	if err := handler.Handle(2, "a 'b' $(c)"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	content, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read temp file: %v", err)
+	}
+	if want := "2|a 'b' $(c)"; string(content) != want {
+		t.Errorf("handler output = %q, want %q", string(content), want)
+	}
+
+	if err := NewExecHandler([]string{}).Handle(1, ""); err == nil {
+		t.Error("expected error for empty argv, got nil")
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ContextHandler defines the interface for handlers that can be canceled.
+// HandleEventContext must return promptly once ctx is done.
+type ContextHandler interface {
+	HandleEventContext(ctx context.Context, event *FailureEvent) error
+	Description() string
+}
+
+// AdaptContext returns handler as a ContextHandler. Handlers that do not
+// implement ContextHandler run in their own goroutine, which is abandoned
+// when ctx is done so that a stuck handler cannot block its caller.
+func AdaptContext(handler EventHandler) ContextHandler {
+	if ch, ok := handler.(ContextHandler); ok {
+		return ch
+	}
+	return &eventHandlerAdapter{handler: handler}
+}
+
+// eventHandlerAdapter delivers events to an EventHandler that does not
+// support cancellation
+type eventHandlerAdapter struct {
+	handler EventHandler
+}
+
+// HandleEventContext runs the wrapped handler until it returns or ctx is done
+func (a *eventHandlerAdapter) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	return runContext(ctx, func() error {
+		return a.handler.HandleEvent(event)
+	})
+}
+
+// HandleEvent calls the wrapped handler
+func (a *eventHandlerAdapter) HandleEvent(event *FailureEvent) error {
+	return a.handler.HandleEvent(event)
+}
+
+// Description returns the description of the wrapped handler
+func (a *eventHandlerAdapter) Description() string {
+	return a.handler.Description()
+}
+
+// runContext runs fn in its own goroutine and returns its error, or ctx.Err()
+// if ctx is done first. fn keeps running in the background in that case.
+func runContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unwrapper is implemented by handlers that decorate another handler
+type Unwrapper interface {
+	Unwrap() EventHandler
+}
+
+// findDecorator reports whether handler or any handler it wraps satisfies
+// match
+func findDecorator(handler EventHandler, match func(EventHandler) bool) bool {
+	for handler != nil {
+		if match(handler) {
+			return true
+		}
+		u, ok := handler.(Unwrapper)
+		if !ok {
+			return false
+		}
+		handler = u.Unwrap()
+	}
+	return false
+}
+
+// HasTimeout reports whether handler or a handler it wraps has its own
+// timeout
+func HasTimeout(handler EventHandler) bool {
+	return findDecorator(handler, func(h EventHandler) bool {
+		_, ok := h.(*TimeoutHandler)
+		return ok
+	})
+}
+
+// TimeoutHandler abandons a handler that runs longer than its timeout
+type TimeoutHandler struct {
+	handler EventHandler
+	timeout time.Duration
+}
+
+// WithTimeout returns handler limited to run for at most timeout. A zero
+// timeout means no limit.
+func WithTimeout(handler EventHandler, timeout time.Duration) *TimeoutHandler {
+	return &TimeoutHandler{
+		handler: handler,
+		timeout: timeout,
+	}
+}
+
+// HandleEventContext runs the wrapped handler with the timeout applied
+func (h *TimeoutHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	handler := AdaptContext(h.handler)
+	if h.timeout <= 0 {
+		return handler.HandleEventContext(ctx, event)
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := handler.HandleEventContext(handlerCtx, event)
+	if err != nil && ctx.Err() == nil && errors.Is(handlerCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v: %w", h.timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// Handle runs the wrapped handler with the timeout applied
+func (h *TimeoutHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent runs the wrapped handler with the timeout applied
+func (h *TimeoutHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// Description returns the description of the wrapped handler
+func (h *TimeoutHandler) Description() string {
+	return h.handler.Description()
+}
+
+// Unwrap returns the wrapped handler
+func (h *TimeoutHandler) Unwrap() EventHandler {
+	return h.handler
+}
+
+// Timeout returns the timeout of the handler
+func (h *TimeoutHandler) Timeout() time.Duration {
+	return h.timeout
+}
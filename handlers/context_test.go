@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingHandler ignores cancellation and blocks until release is closed
+type blockingHandler struct {
+	release chan struct{}
+}
+
+func (h *blockingHandler) HandleEvent(event *FailureEvent) error {
+	<-h.release
+	return nil
+}
+
+func (h *blockingHandler) Description() string {
+	return "Blocking handler"
+}
+
+func TestAdaptContextAbandonsHandler(t *testing.T) {
+	blocked := &blockingHandler{release: make(chan struct{})}
+	defer close(blocked.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := AdaptContext(blocked).HandleEventContext(ctx, NewFailureEvent(1, ""))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, want the handler abandoned", elapsed)
+	}
+}
+
+func TestAdaptContextKeepsContextHandlers(t *testing.T) {
+	handler := NewSlackHandler("https://example.com", "x")
+	if got := AdaptContext(handler); got != ContextHandler(handler) {
+		t.Errorf("AdaptContext wrapped a ContextHandler: %T", got)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	blocked := &blockingHandler{release: make(chan struct{})}
+	defer close(blocked.release)
+
+	handler := WithTimeout(blocked, 50*time.Millisecond)
+	err := handler.HandleEvent(NewFailureEvent(1, ""))
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("error = %v, want timed out after 50ms", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+	if handler.Description() != "Blocking handler" || handler.Timeout() != 50*time.Millisecond {
+		t.Errorf("Description(), Timeout() = %q, %v", handler.Description(), handler.Timeout())
+	}
+
+	// The caller's own cancellation is reported as is
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := handler.HandleEventContext(ctx, NewFailureEvent(1, "")); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+
+	// Zero means no limit
+	if err := WithTimeout(NewCommandHandler("sleep 0.1"), 0).HandleEvent(NewFailureEvent(1, "")); err != nil {
+		t.Errorf("zero timeout: %v", err)
+	}
+}
+
+func TestCommandHandlerCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := NewCommandHandler("sleep 10; echo never").HandleEventContext(ctx, NewFailureEvent(1, ""))
+	if err == nil {
+		t.Error("error = nil, want the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want the command killed at the deadline", elapsed)
+	}
+}
+
+func TestHTTPHandlersCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tests := map[string]ContextHandler{
+		"webhook": NewWebhookHandler(server.URL),
+		"slack":   NewSlackHandler(server.URL, "x"),
+		"discord": NewDiscordHandler(server.URL, "x"),
+		"ntfy":    NewNtfyHandler(server.URL+"/topic", "x"),
+		"http":    NewHTTPHandler(server.URL),
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			err := handler.HandleEventContext(ctx, NewFailureEvent(1, ""))
+			if !errors.Is(err, context.DeadlineExceeded) && (err == nil || !strings.Contains(err.Error(), "deadline exceeded")) {
+				t.Errorf("error = %v, want deadline exceeded", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+func init() {
+	RegisterScheme("discord", newDiscordHandlerFromURL)
+}
+
+// DiscordHandler sends a message to a Discord webhook on failure
+type DiscordHandler struct {
+	webhookURL string
+	message    string
+	username   string
+	registry   *PlaceholderRegistry
+}
+
+// DiscordMessage represents a Discord webhook payload
+type DiscordMessage struct {
+	Content  string `json:"content"`
+	Username string `json:"username,omitempty"`
+}
+
+// discordMaxContent is the longest message Discord accepts
+const discordMaxContent = 2000
+
+// NewDiscordHandler creates a new DiscordHandler with the specified webhook URL and message
+func NewDiscordHandler(webhookURL, message string, options ...func(*DiscordHandler)) *DiscordHandler {
+	handler := &DiscordHandler{
+		webhookURL: webhookURL,
+		message:    message,
+		username:   "FailHook",
+		registry:   NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithDiscordUsername sets the username for the Discord message
+func WithDiscordUsername(username string) func(*DiscordHandler) {
+	return func(h *DiscordHandler) {
+		h.username = username
+	}
+}
+
+// newDiscordHandlerFromURL parses discord://TOKEN@WEBHOOK_ID with optional
+// message and username query parameters
+func newDiscordHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	token := u.User.Username()
+	if token == "" || u.Host == "" {
+		return nil, fmt.Errorf("discord URL must look like discord://TOKEN@WEBHOOK_ID")
+	}
+
+	webhookURL := fmt.Sprintf("https://discord.com/api/webhooks/%s/%s", url.PathEscape(u.Host), url.PathEscape(token))
+	var options []func(*DiscordHandler)
+	if username := u.Query().Get("username"); username != "" {
+		options = append(options, WithDiscordUsername(username))
+	}
+	return NewDiscordHandler(webhookURL, queryMessage(u), options...), nil
+}
+
+// Handle sends a message to Discord with placeholders replaced
+func (h *DiscordHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent sends a message to Discord with placeholders replaced
+func (h *DiscordHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext sends a message to Discord with placeholders replaced, giving up when ctx is done
+func (h *DiscordHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	message := TruncateBytes(h.registry.ReplaceEvent(h.message, event), discordMaxContent)
+
+	payload, err := json.Marshal(DiscordMessage{Content: message, Username: h.username})
+	if err != nil {
+		return Permanent(fmt.Errorf("error marshaling Discord message: %v", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return Permanent(fmt.Errorf("error creating Discord request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending Discord message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Discord answers 204 No Content, or 200 when asked to wait
+	if resp.StatusCode >= 300 {
+		return NewHTTPStatusError("discord API", resp)
+	}
+
+	return nil
+}
+
+// Description returns a description of the handler
+func (h *DiscordHandler) Description() string {
+	return fmt.Sprintf("Send to Discord: %s", h.message)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiscordHandler(t *testing.T) {
+	var received DiscordMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("Failed to unmarshal Discord message: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler := NewDiscordHandler(server.URL, "Error: __STATUS_CODE__ - __OUTPUT__", WithDiscordUsername("cron"))
+	if err := handler.Handle(2, "disk full"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if received.Content != "Error: 2 - disk full" {
+		t.Errorf("content = %q", received.Content)
+	}
+	if received.Username != "cron" {
+		t.Errorf("username = %q, want cron", received.Username)
+	}
+}
+
+func TestDiscordHandlerTruncatesContent(t *testing.T) {
+	var received DiscordMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	handler := NewDiscordHandler(server.URL, "__OUTPUT__")
+	if err := handler.Handle(1, strings.Repeat("x", 3000)); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+	if len(received.Content) > discordMaxContent {
+		t.Errorf("content length = %d, want at most %d", len(received.Content), discordMaxContent)
+	}
+}
+
+func TestDiscordHandlerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	handler := NewDiscordHandler(server.URL, "test")
+	if err := handler.Handle(1, "error"); err == nil {
+		t.Error("Expected error for 400 response, got nil")
+	}
+}
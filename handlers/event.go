@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventVersion is the version of the FailureEvent structure. It is increased
+// whenever a field is removed or changes meaning; adding fields does not
+// change the version.
+const EventVersion = 1
+
+// Phases of a run, each with its own set of handlers
+const (
+	// PhaseStart is before the monitored command starts
+	PhaseStart = "start"
+	// PhaseSuccess is after the command succeeded
+	PhaseSuccess = "success"
+	// PhaseFailure is after the command failed
+	PhaseFailure = "failure"
+	// PhaseFinish is after the command ended, whether it succeeded or not
+	PhaseFinish = "finish"
+)
+
+// Outcomes of a run
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// ValidPhase reports whether phase is one of the Phase* constants
+func ValidPhase(phase string) bool {
+	switch phase {
+	case PhaseStart, PhaseSuccess, PhaseFailure, PhaseFinish:
+		return true
+	}
+	return false
+}
+
+// FailureEvent describes a run of the monitored command. Despite its name it
+// is also delivered to the handlers of the start, success and finish phases.
+type FailureEvent struct {
+	Version int `json:"version"`
+	// RunID uniquely identifies the run
+	RunID string `json:"run_id"`
+	// Phase is the phase whose handlers receive the event
+	Phase string `json:"phase"`
+	// Outcome is OutcomeSuccess or OutcomeFailure once the command ended,
+	// and empty in the start phase
+	Outcome string `json:"outcome"`
+
+	// Command is the full command line
+	Command     string   `json:"command"`
+	CommandName string   `json:"command_name"`
+	Args        []string `json:"args"`
+	// PID is the process ID of the monitored command, or 0 if it never started
+	PID        int    `json:"pid,omitempty"`
+	WorkingDir string `json:"working_dir"`
+	User       string `json:"user"`
+	Hostname   string `json:"hostname"`
+	// FQDN is the fully qualified domain name of the host. It is usually
+	// left empty and resolved from Hostname by HostFQDN when needed.
+	FQDN string `json:"fqdn"`
+
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Duration  time.Duration `json:"duration_ns"`
+
+	ExitCode int `json:"exit_code"`
+	// Signal is the number of the signal that killed the command, or 0
+	Signal      int  `json:"signal,omitempty"`
+	TimedOut    bool `json:"timed_out"`
+	Interrupted bool `json:"interrupted"`
+
+	// Output is the combined stdout and stderr formatted according to the
+	// capture mode
+	Output string `json:"output"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	// Lines holds every output line of both streams in arrival order
+	Lines []OutputLine `json:"lines,omitempty"`
+
+	// Attempts describes every run of the command in order when it was
+	// retried; the last attempt is the one described above. It is empty for
+	// commands that ran once.
+	Attempts []Attempt `json:"attempts,omitempty"`
+
+	// Match is the output line that broke an output rule such as
+	// -fail-on-regex, if any
+	Match string `json:"match,omitempty"`
+	// OutputFailure describes the broken output rule if the command failed
+	// only because of its output, e.g. after exiting 0
+	OutputFailure string `json:"output_failure,omitempty"`
+
+	// Job names the job in the state directory; the fields below are set
+	// only when failhook keeps state between runs (see -state-dir)
+	Job string `json:"job,omitempty"`
+	// PreviousOutcome is the outcome of the job's previous run, or
+	// OutcomeSuccess for its first run
+	PreviousOutcome string `json:"previous_outcome,omitempty"`
+	// ConsecutiveFailures counts the failed runs in a row up to this one.
+	// When the run recovers from failures, it counts the failures that just
+	// ended.
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	// FailingSince is when the first of the consecutive failures started
+	FailingSince time.Time `json:"failing_since"`
+}
+
+// MarshalJSON encodes the event with the FQDN resolved
+func (e FailureEvent) MarshalJSON() ([]byte, error) {
+	type event FailureEvent
+	encoded := event(e)
+	encoded.FQDN = e.HostFQDN()
+	return json.Marshal(encoded)
+}
+
+// HostFQDN returns FQDN, or if it is empty the fully qualified domain name
+// of Hostname, falling back to Hostname itself if it cannot be resolved
+// within FQDNLookupTimeout
+func (e *FailureEvent) HostFQDN() string {
+	if e.FQDN != "" {
+		return e.FQDN
+	}
+	return LookupFQDN(e.Hostname)
+}
+
+// FQDNLookupTimeout limits how long LookupFQDN waits for the resolver, so
+// that a broken resolver does not hold up failure reports
+const FQDNLookupTimeout = 2 * time.Second
+
+var (
+	fqdnMu    sync.Mutex
+	fqdnCache = make(map[string]string)
+)
+
+// LookupFQDN returns the fully qualified domain name of hostname, falling
+// back to hostname itself if it cannot be resolved. Results are cached, so
+// the resolver is asked at most once per host name.
+func LookupFQDN(hostname string) string {
+	if hostname == "" {
+		return ""
+	}
+	fqdnMu.Lock()
+	defer fqdnMu.Unlock()
+	if fqdn, ok := fqdnCache[hostname]; ok {
+		return fqdn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FQDNLookupTimeout)
+	defer cancel()
+	fqdn := hostname
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, hostname); err == nil && cname != "" {
+		fqdn = strings.TrimSuffix(cname, ".")
+	}
+	fqdnCache[hostname] = fqdn
+	return fqdn
+}
+
+// Attempt describes one run of a retried command
+type Attempt struct {
+	ExitCode int `json:"exit_code"`
+	// Signal is the number of the signal that killed the command, or 0
+	Signal    int           `json:"signal,omitempty"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// AttemptCount returns how often the command ran
+func (e *FailureEvent) AttemptCount() int {
+	if len(e.Attempts) == 0 {
+		return 1
+	}
+	return len(e.Attempts)
+}
+
+// AttemptExitCodes returns the exit code of every run of the command in order
+func (e *FailureEvent) AttemptExitCodes() []int {
+	if len(e.Attempts) == 0 {
+		return []int{e.ExitCode}
+	}
+	codes := make([]int, len(e.Attempts))
+	for i, attempt := range e.Attempts {
+		codes[i] = attempt.ExitCode
+	}
+	return codes
+}
+
+// joinInts joins numbers with commas, e.g. "1,1,2"
+func joinInts(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+// NewFailureEvent creates a FailureEvent carrying only an exit code and output
+func NewFailureEvent(exitCode int, output string) *FailureEvent {
+	return &FailureEvent{
+		Version:  EventVersion,
+		Phase:    PhaseFailure,
+		Outcome:  OutcomeFailure,
+		ExitCode: exitCode,
+		Output:   output,
+	}
+}
+
+// Summary describes what happened to the command in a few words, e.g.
+// "started", "succeeded" or "failed with exit code 2"
+func (e *FailureEvent) Summary() string {
+	switch {
+	case e.Phase == PhaseStart:
+		return "started"
+	case e.Outcome == OutcomeSuccess:
+		return "succeeded"
+	case e.OutputFailure != "":
+		return "failed: " + e.OutputFailure
+	default:
+		return "failed with exit code " + strconv.Itoa(e.ExitCode)
+	}
+}
+
+// Changed reports whether the outcome of the run differs from the outcome
+// of the previous run, i.e. the job started failing or recovered. Without
+// state it reports true for every run that ended, and false in the start
+// phase.
+func (e *FailureEvent) Changed() bool {
+	if e.Outcome == "" {
+		return false
+	}
+	return e.PreviousOutcome == "" || e.Outcome != e.PreviousOutcome
+}
+
+// NewRunID returns a random identifier for a run
+func NewRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// EventHandler defines the interface for handlers that receive the full
+// FailureEvent rather than only the exit code and combined output
+type EventHandler interface {
+	HandleEvent(event *FailureEvent) error
+	Description() string
+}
+
+// AdaptHandler returns handler as an EventHandler. Handlers that only
+// implement FailureHandler receive the event's exit code and output.
+func AdaptHandler(handler FailureHandler) EventHandler {
+	if eh, ok := handler.(EventHandler); ok {
+		return eh
+	}
+	return &failureHandlerAdapter{handler: handler}
+}
+
+// failureHandlerAdapter delivers events to a plain FailureHandler
+type failureHandlerAdapter struct {
+	handler FailureHandler
+}
+
+// HandleEvent calls the wrapped handler with the exit code and output
+func (a *failureHandlerAdapter) HandleEvent(event *FailureEvent) error {
+	return a.handler.Handle(event.ExitCode, event.Output)
+}
+
+// Description returns the description of the wrapped handler
+func (a *failureHandlerAdapter) Description() string {
+	return a.handler.Description()
+}
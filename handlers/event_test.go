@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// recordingHandler is a plain FailureHandler recording its last call
+type recordingHandler struct {
+	exitCode int
+	output   string
+}
+
+func (h *recordingHandler) Handle(exitCode int, output string) error {
+	h.exitCode = exitCode
+	h.output = output
+	return nil
+}
+
+func (h *recordingHandler) Description() string {
+	return "Recording handler"
+}
+
+func TestAdaptHandler(t *testing.T) {
+	// Plain handlers receive the exit code and output of the event
+	plain := &recordingHandler{}
+	adapted := AdaptHandler(plain)
+
+	event := &FailureEvent{ExitCode: 3, Output: "combined", Stderr: "stderr only"}
+	if err := adapted.HandleEvent(event); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if plain.exitCode != 3 || plain.output != "combined" {
+		t.Errorf("handler received (%d, %q), want (3, %q)", plain.exitCode, plain.output, "combined")
+	}
+	if adapted.Description() != plain.Description() {
+		t.Errorf("Description() = %q, want %q", adapted.Description(), plain.Description())
+	}
+
+	// Handlers that already handle events are returned as is
+	command := NewCommandHandler("true")
+	if AdaptHandler(command) != EventHandler(command) {
+		t.Error("AdaptHandler wrapped a handler that implements EventHandler")
+	}
+}
+
+func TestFailureEventJSON(t *testing.T) {
+	event := NewFailureEvent(2, "boom")
+	event.Lines = []OutputLine{{Stream: StreamStderr, Text: "boom"}}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if decoded["version"] != float64(EventVersion) {
+		t.Errorf("version = %v, want %d", decoded["version"], EventVersion)
+	}
+	if decoded["exit_code"] != float64(2) {
+		t.Errorf("exit_code = %v, want 2", decoded["exit_code"])
+	}
+	lines, ok := decoded["lines"].([]interface{})
+	if !ok || len(lines) != 1 {
+		t.Errorf("lines = %v, want one line", decoded["lines"])
+	}
+}
+
+func TestFailureEventChanged(t *testing.T) {
+	tests := []struct {
+		event *FailureEvent
+		want  bool
+	}{
+		{&FailureEvent{Phase: PhaseStart}, false},
+		{&FailureEvent{Outcome: OutcomeFailure}, true},
+		{&FailureEvent{Outcome: OutcomeFailure, PreviousOutcome: OutcomeSuccess}, true},
+		{&FailureEvent{Outcome: OutcomeFailure, PreviousOutcome: OutcomeFailure}, false},
+		{&FailureEvent{Outcome: OutcomeSuccess, PreviousOutcome: OutcomeFailure}, true},
+		{&FailureEvent{Outcome: OutcomeSuccess, PreviousOutcome: OutcomeSuccess}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.event.Changed(); got != tt.want {
+			t.Errorf("Changed() of %q after %q = %v, want %v", tt.event.Outcome, tt.event.PreviousOutcome, got, tt.want)
+		}
+	}
+}
+
+func TestFailureEventSummary(t *testing.T) {
+	tests := []struct {
+		event *FailureEvent
+		want  string
+	}{
+		{&FailureEvent{Phase: PhaseStart}, "started"},
+		{&FailureEvent{Phase: PhaseSuccess, Outcome: OutcomeSuccess}, "succeeded"},
+		{&FailureEvent{Phase: PhaseFinish, Outcome: OutcomeSuccess, ExitCode: 3}, "succeeded"},
+		{NewFailureEvent(2, ""), "failed with exit code 2"},
+		{&FailureEvent{Phase: PhaseFinish, Outcome: OutcomeFailure, OutputFailure: "output was written to stderr"}, "failed: output was written to stderr"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.event.Summary(); got != tt.want {
+			t.Errorf("Summary() of %s event = %q, want %q", tt.event.Phase, got, tt.want)
+		}
+	}
+}
+
+func TestHostFQDN(t *testing.T) {
+	// Seed the cache so that the test does not depend on the resolver
+	fqdnMu.Lock()
+	fqdnCache["web1"] = "web1.example.com"
+	fqdnMu.Unlock()
+
+	event := &FailureEvent{Hostname: "web1"}
+	if got := event.HostFQDN(); got != "web1.example.com" {
+		t.Errorf("HostFQDN() = %q, want the resolved name", got)
+	}
+	if got := (&FailureEvent{Hostname: "web1", FQDN: "web1.internal"}).HostFQDN(); got != "web1.internal" {
+		t.Errorf("HostFQDN() = %q, want the FQDN already set", got)
+	}
+
+	// The JSON event carries the resolved name
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(payload, &decoded); err != nil || decoded["fqdn"] != "web1.example.com" {
+		t.Errorf("fqdn = %v, %v, want web1.example.com", decoded["fqdn"], err)
+	}
+	if event.FQDN != "" {
+		t.Error("Marshal changed the event")
+	}
+}
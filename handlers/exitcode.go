@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExitCodeRange is an inclusive range of exit codes
+type ExitCodeRange struct {
+	Min, Max int
+}
+
+// ExitCodes is a set of exit codes made of single codes and ranges
+type ExitCodes []ExitCodeRange
+
+// ParseExitCodes parses a comma-separated list of exit codes and ranges such
+// as "1,3,64-78"
+func ParseExitCodes(spec string) (ExitCodes, error) {
+	var codes ExitCodes
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(part, "-")
+		min, err := parseExitCode(low)
+		if err != nil {
+			return nil, err
+		}
+		max := min
+		if isRange {
+			if max, err = parseExitCode(high); err != nil {
+				return nil, err
+			}
+			if max < min {
+				return nil, fmt.Errorf("invalid exit code range %q", part)
+			}
+		}
+		codes = append(codes, ExitCodeRange{Min: min, Max: max})
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no exit codes in %q", spec)
+	}
+	return codes, nil
+}
+
+// parseExitCode parses a single exit code between 0 and 255
+func parseExitCode(value string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || code < 0 || code > 255 {
+		return 0, fmt.Errorf("invalid exit code %q (want 0-255)", value)
+	}
+	return code, nil
+}
+
+// Contains reports whether code is in the set
+func (c ExitCodes) Contains(code int) bool {
+	for _, r := range c {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the set as accepted by ParseExitCodes
+func (c ExitCodes) String() string {
+	parts := make([]string, len(c))
+	for i, r := range c {
+		if r.Min == r.Max {
+			parts[i] = strconv.Itoa(r.Min)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.Min, r.Max)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Filter matches events whose exit code is in the set
+func (c ExitCodes) Filter() EventFilter {
+	return func(event *FailureEvent) bool {
+		return c.Contains(event.ExitCode)
+	}
+}
+
+// Classes of failures, telling how the command ended
+const (
+	// ClassTimeout is a command killed by failhook's timeout (exit code 124)
+	ClassTimeout = "timeout"
+	// ClassInterrupt is a command canceled by SIGINT or SIGTERM sent to
+	// failhook (exit code 130)
+	ClassInterrupt = "interrupt"
+	// ClassSignal is a command killed by a signal (exit code 128+N)
+	ClassSignal = "signal"
+	// ClassExit is a command that exited on its own with a nonzero code
+	ClassExit = "exit"
+	// ClassOutput is a command whose exit code was not a failure, but whose
+	// output broke an output rule
+	ClassOutput = "output"
+)
+
+// ValidClass reports whether class is one of the Class* constants
+func ValidClass(class string) bool {
+	switch class {
+	case ClassTimeout, ClassInterrupt, ClassSignal, ClassExit, ClassOutput:
+		return true
+	}
+	return false
+}
+
+// Class returns the class of the failure
+func (e *FailureEvent) Class() string {
+	switch {
+	case e.TimedOut:
+		return ClassTimeout
+	case e.Interrupted:
+		return ClassInterrupt
+	case e.Signal != 0:
+		return ClassSignal
+	case e.OutputFailure != "":
+		return ClassOutput
+	default:
+		return ClassExit
+	}
+}
+
+// ClassFilter matches events of one of the given classes
+func ClassFilter(classes ...string) EventFilter {
+	return func(event *FailureEvent) bool {
+		class := event.Class()
+		for _, c := range classes {
+			if c == class {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AnyFilter matches events that at least one filter matches
+func AnyFilter(filters ...EventFilter) EventFilter {
+	return func(event *FailureEvent) bool {
+		for _, filter := range filters {
+			if filter(event) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := ParseExitCodes("1, 3,64-78")
+	if err != nil {
+		t.Fatalf("ParseExitCodes failed: %v", err)
+	}
+	if codes.String() != "1,3,64-78" {
+		t.Errorf("String() = %q", codes.String())
+	}
+	for code, want := range map[int]bool{0: false, 1: true, 2: false, 3: true, 64: true, 70: true, 78: true, 79: false} {
+		if codes.Contains(code) != want {
+			t.Errorf("Contains(%d) = %v, want %v", code, !want, want)
+		}
+	}
+
+	for _, spec := range []string{"", ",", "x", "5-2", "256", "-1", "1-"} {
+		if _, err := ParseExitCodes(spec); err == nil {
+			t.Errorf("ParseExitCodes(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestEventClass(t *testing.T) {
+	tests := []struct {
+		event *FailureEvent
+		want  string
+	}{
+		{&FailureEvent{ExitCode: 124, TimedOut: true}, ClassTimeout},
+		{&FailureEvent{ExitCode: 130, Interrupted: true}, ClassInterrupt},
+		{&FailureEvent{ExitCode: 137, Signal: 9}, ClassSignal},
+		{&FailureEvent{ExitCode: 124}, ClassExit},
+		{&FailureEvent{OutputFailure: "output matched \"ERROR\""}, ClassOutput},
+	}
+	for _, tt := range tests {
+		if got := tt.event.Class(); got != tt.want {
+			t.Errorf("Class() of %+v = %q, want %q", tt.event, got, tt.want)
+		}
+	}
+
+	filter := AnyFilter(ClassFilter(ClassSignal, ClassTimeout), ExitCodes{{Min: 2, Max: 2}}.Filter())
+	for _, tt := range []struct {
+		event *FailureEvent
+		want  bool
+	}{
+		{&FailureEvent{ExitCode: 137, Signal: 9}, true},
+		{&FailureEvent{ExitCode: 124, TimedOut: true}, true},
+		{&FailureEvent{ExitCode: 2}, true},
+		{&FailureEvent{ExitCode: 1}, false},
+	} {
+		if got := filter(tt.event); got != tt.want {
+			t.Errorf("filter(%+v) = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FilterFunc transforms a placeholder value. args holds the filter's
+// arguments as written in the template.
+type FilterFunc func(value string, args []string) (string, error)
+
+// filter is a registered filter
+type filter struct {
+	fn FilterFunc
+	// escapes is set for filters that encode the value for a specific
+	// context, which replaces the handler's default escaping
+	escapes bool
+}
+
+// defaultFilters returns the filters available in every registry
+func defaultFilters() map[string]filter {
+	return map[string]filter{
+		"tail":     {fn: filterTail},
+		"head":     {fn: filterHead},
+		"max":      {fn: filterMaxBytes},
+		"maxbytes": {fn: filterMaxBytes},
+		"trim":     {fn: noArgs(strings.TrimSpace)},
+		"upper":    {fn: noArgs(strings.ToUpper)},
+		"lower":    {fn: noArgs(strings.ToLower)},
+		"default":  {fn: filterDefault},
+		"format":   {fn: filterTimeFormat},
+		"tz":       {fn: filterTimezone},
+		"json":     {fn: noArgs(JSONEscape), escapes: true},
+		"shell":    {fn: noArgs(ShellQuote), escapes: true},
+		"url":      {fn: noArgs(url.QueryEscape), escapes: true},
+		"urlquery": {fn: noArgs(url.QueryEscape), escapes: true},
+		"urlpath":  {fn: noArgs(url.PathEscape), escapes: true},
+		"html":     {fn: noArgs(html.EscapeString), escapes: true},
+		"base64":   {fn: noArgs(base64Encode), escapes: true},
+		"raw":      {fn: noArgs(func(s string) string { return s }), escapes: true},
+	}
+}
+
+// noArgs adapts a plain string function to a FilterFunc taking no arguments
+func noArgs(fn func(string) string) FilterFunc {
+	return func(value string, args []string) (string, error) {
+		if len(args) != 0 {
+			return "", fmt.Errorf("takes no arguments")
+		}
+		return fn(value), nil
+	}
+}
+
+// JSONEscape escapes s for use inside a JSON string literal
+func JSONEscape(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	quoted := strings.TrimSuffix(buf.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
+
+// base64Encode encodes s in standard base64
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// ShellQuote quotes s as a single POSIX shell word
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Shell quoting states tracked by shellEscaper
+const (
+	shellUnquoted = iota
+	shellSingleQuoted
+	shellDoubleQuoted
+)
+
+// shellContext is the quoting state within one level of command
+// substitution
+type shellContext struct {
+	state int
+	// backtick is set inside `...`, which ends at the next backtick
+	backtick bool
+	// parens counts the parentheses opened inside $(...)
+	parens int
+}
+
+// shellEscaper replaces values with references to environment variables
+// holding them, quoted according to the shell command text preceding them.
+// The shell expands a reference without parsing the value, so a value cannot
+// end its quotes or run commands even where the quoting is misjudged.
+type shellEscaper struct {
+	ctx shellContext
+	// outer holds the contexts around the current command substitution
+	outer   []shellContext
+	escaped bool
+	// dollar is set after a $ that may start a command substitution
+	dollar bool
+	values []string
+}
+
+func (e *shellEscaper) push(backtick bool) {
+	e.outer = append(e.outer, e.ctx)
+	e.ctx = shellContext{backtick: backtick}
+}
+
+func (e *shellEscaper) pop() {
+	e.ctx = e.outer[len(e.outer)-1]
+	e.outer = e.outer[:len(e.outer)-1]
+}
+
+func (e *shellEscaper) literal(text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		dollar := e.dollar
+		e.dollar = false
+		if e.escaped {
+			e.escaped = false
+			continue
+		}
+		if e.ctx.state == shellSingleQuoted {
+			switch {
+			case c == '\'':
+				e.ctx.state = shellUnquoted
+			case c == '`' && e.ctx.backtick:
+				e.pop()
+			}
+			continue
+		}
+		switch {
+		case c == '\\':
+			e.escaped = true
+		case c == '`' && e.ctx.backtick:
+			e.pop()
+		case c == '`':
+			e.push(true)
+		case c == '$':
+			e.dollar = true
+		case c == '(' && dollar:
+			e.push(false)
+		case c == '"' && e.ctx.state == shellDoubleQuoted:
+			e.ctx.state = shellUnquoted
+		case c == '"':
+			e.ctx.state = shellDoubleQuoted
+		case e.ctx.state == shellDoubleQuoted:
+		case c == '\'':
+			e.ctx.state = shellSingleQuoted
+		case c == '(':
+			e.ctx.parens++
+		case c == ')' && e.ctx.parens > 0:
+			e.ctx.parens--
+		case c == ')' && len(e.outer) > 0 && !e.ctx.backtick:
+			e.pop()
+		}
+	}
+}
+
+func (e *shellEscaper) escape(value string) string {
+	e.values = append(e.values, value)
+	e.escaped, e.dollar = false, false
+	name := shellValueName(len(e.values))
+	switch e.ctx.state {
+	case shellSingleQuoted:
+		return `'"${` + name + `}"'`
+	case shellDoubleQuoted:
+		return "${" + name + "}"
+	}
+	return `"${` + name + `}"`
+}
+
+// env returns the variables referenced by the escaped values
+func (e *shellEscaper) env() []string {
+	env := make([]string, len(e.values))
+	for i, value := range e.values {
+		env[i] = shellValueName(i+1) + "=" + value
+	}
+	return env
+}
+
+// shellValueName returns the variable holding the nth value inserted into a
+// shell command, e.g. FAILHOOK_EVENT_VALUE_1
+func shellValueName(n int) string {
+	return EventEnvPrefix + "VALUE_" + strconv.Itoa(n)
+}
+
+// HeadLines returns the first n lines of text
+func HeadLines(text string, n int) string {
+	text = strings.TrimLeft(text, "\r\n")
+	if n <= 0 || text == "" {
+		return ""
+	}
+	lines := strings.SplitN(text, "\n", n+1)
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TruncateBytes shortens s to at most n bytes without splitting a UTF-8
+// character
+func TruncateBytes(s string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// intArg parses the single integer argument of a filter
+func intArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("takes exactly one argument")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("argument %q is not a non-negative integer", args[0])
+	}
+	return n, nil
+}
+
+func filterTail(value string, args []string) (string, error) {
+	n, err := intArg(args)
+	if err != nil {
+		return "", err
+	}
+	return TailLines(value, n), nil
+}
+
+func filterHead(value string, args []string) (string, error) {
+	n, err := intArg(args)
+	if err != nil {
+		return "", err
+	}
+	return HeadLines(value, n), nil
+}
+
+func filterMaxBytes(value string, args []string) (string, error) {
+	n, err := intArg(args)
+	if err != nil {
+		return "", err
+	}
+	return TruncateBytes(value, n), nil
+}
+
+func filterDefault(value string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("takes exactly one argument")
+	}
+	if value == "" {
+		return args[0], nil
+	}
+	return value, nil
+}
+
+// timeLayouts maps the layout names accepted by the format filter
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"UnixDate":    time.UnixDate,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// filterTimeFormat reformats an RFC3339 time using a Go layout, a layout name
+// such as RFC1123, or "unix" for seconds since the epoch
+func filterTimeFormat(value string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("takes exactly one argument")
+	}
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", fmt.Errorf("value %q is not a time", value)
+	}
+	if args[0] == "unix" {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	if layout, ok := timeLayouts[args[0]]; ok {
+		return t.Format(layout), nil
+	}
+	return t.Format(args[0]), nil
+}
+
+// filterTimezone converts an RFC3339 time to the named time zone
+func filterTimezone(value string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("takes exactly one argument")
+	}
+	loc, err := time.LoadLocation(args[0])
+	if err != nil {
+		return "", fmt.Errorf("unknown time zone %q", args[0])
+	}
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", fmt.Errorf("value %q is not a time", value)
+	}
+	return t.In(loc).Format(time.RFC3339), nil
+}
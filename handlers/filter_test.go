@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	filters := defaultFilters()
+
+	tests := []struct {
+		filter  string
+		value   string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{filter: "tail", value: "a\nb\nc", args: []string{"2"}, want: "b\nc"},
+		{filter: "head", value: "a\nb\nc", args: []string{"2"}, want: "a\nb"},
+		{filter: "max", value: "abcdef", args: []string{"3"}, want: "abc"},
+		{filter: "maxbytes", value: "héllo", args: []string{"2"}, want: "h"},
+		{filter: "upper", value: "abc", want: "ABC"},
+		{filter: "lower", value: "ABC", want: "abc"},
+		{filter: "trim", value: "  abc\n", want: "abc"},
+		{filter: "default", value: "", args: []string{"none"}, want: "none"},
+		{filter: "default", value: "set", args: []string{"none"}, want: "set"},
+		{filter: "json", value: "say \"hi\"\n<b>", want: `say \"hi\"\n<b>`},
+		{filter: "shell", value: "it's $(bad)", want: `'it'\''s $(bad)'`},
+		{filter: "url", value: "a b&c", want: "a+b%26c"},
+		{filter: "urlpath", value: "a b/c", want: "a%20b%2Fc"},
+		{filter: "html", value: "<a & b>", want: "&lt;a &amp; b&gt;"},
+		{filter: "base64", value: "hello", want: "aGVsbG8="},
+		{filter: "format", value: "2025-03-04T05:06:07Z", args: []string{"2006/01/02"}, want: "2025/03/04"},
+		{filter: "format", value: "2025-03-04T05:06:07Z", args: []string{"DateTime"}, want: "2025-03-04 05:06:07"},
+		{filter: "format", value: "2025-03-04T05:06:07Z", args: []string{"unix"}, want: "1741064767"},
+		{filter: "tz", value: "2025-03-04T05:06:07Z", args: []string{"Asia/Tokyo"}, want: "2025-03-04T14:06:07+09:00"},
+		{filter: "tail", value: "a", wantErr: true},
+		{filter: "tail", value: "a", args: []string{"x"}, wantErr: true},
+		{filter: "upper", value: "a", args: []string{"x"}, wantErr: true},
+		{filter: "format", value: "not a time", args: []string{"2006"}, wantErr: true},
+		{filter: "tz", value: "2025-03-04T05:06:07Z", args: []string{"Nowhere/Special"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := filters[tt.filter].fn(tt.value, tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%s(%q, %q) error = nil, want error", tt.filter, tt.value, tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s(%q, %q) failed: %v", tt.filter, tt.value, tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s(%q, %q) = %q, want %q", tt.filter, tt.value, tt.args, got, tt.want)
+			}
+		})
+	}
+}
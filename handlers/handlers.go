@@ -1,72 +1,87 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log/syslog"
 	"net/http"
-	"os"
-	"os/exec"
+	"net/url"
 )
 
+func init() {
+	RegisterScheme("http", newWebhookHandlerFromURL)
+	RegisterScheme("https", newWebhookHandlerFromURL)
+	RegisterScheme("syslog", newSyslogHandlerFromURL)
+}
+
 // FailureHandler defines the interface for handling command failures
 type FailureHandler interface {
 	Handle(exitCode int, output string) error
 	Description() string
 }
 
-// CommandHandler executes a shell command on failure
-type CommandHandler struct {
-	command   string
-	registry *PlaceholderRegistry
-}
-
-// NewCommandHandler creates a new CommandHandler with the specified command
-func NewCommandHandler(command string) *CommandHandler {
-	return &CommandHandler{
-		command:  command,
-		registry: NewPlaceholderRegistry(),
-	}
-}
-
-// Handle executes the shell command with placeholders replaced
-func (h *CommandHandler) Handle(exitCode int, output string) error {
-	// Replace placeholders
-	command := h.registry.Replace(h.command, exitCode, output)
-
-	// Execute shell
-	cmd := exec.Command("sh", "-c", command)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
-}
-
-// Description returns a description of the handler
-func (h *CommandHandler) Description() string {
-	return fmt.Sprintf("Execute command: %s", h.command)
-}
-
 // WebhookHandler calls a webhook URL on failure
 type WebhookHandler struct {
 	webhookURL string
+	signer     *Signer
 	registry   *PlaceholderRegistry
 }
 
 // NewWebhookHandler creates a new WebhookHandler with the specified URL
-func NewWebhookHandler(webhookURL string) *WebhookHandler {
-	return &WebhookHandler{
+func NewWebhookHandler(webhookURL string, options ...func(*WebhookHandler)) *WebhookHandler {
+	handler := &WebhookHandler{
 		webhookURL: webhookURL,
 		registry:   NewPlaceholderRegistry(),
 	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithWebhookSigner signs every request with signer. Webhook requests have
+// no body; the stripe format signs their method, URL path and query, which
+// carry the failure data.
+func WithWebhookSigner(signer *Signer) func(*WebhookHandler) {
+	return func(h *WebhookHandler) {
+		h.signer = signer
+	}
+}
+
+// newWebhookHandlerFromURL uses an http or https URL as a webhook as is
+func newWebhookHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("webhook URL %q has no host", u.String())
+	}
+	return NewWebhookHandler(u.String()), nil
 }
 
 // Handle calls the webhook URL with placeholders replaced
 func (h *WebhookHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent calls the webhook URL with placeholders replaced
+func (h *WebhookHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext calls the webhook URL with placeholders replaced, giving up when ctx is done
+func (h *WebhookHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
 	// Replace placeholders with URL-encoded values
-	webhookURL := h.registry.ReplaceURLEncoded(h.webhookURL, exitCode, output)
+	webhookURL := h.registry.ReplaceEventURLEncoded(h.webhookURL, event)
 
 	// Make HTTP request
-	resp, err := http.Get(webhookURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webhookURL, nil)
+	if err != nil {
+		return err
+	}
+	if h.signer != nil {
+		h.signer.SignRequest(req, nil)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -74,7 +89,7 @@ func (h *WebhookHandler) Handle(exitCode int, output string) error {
 
 	// Check response status
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+		return NewHTTPStatusError("webhook", resp)
 	}
 
 	return nil
@@ -99,20 +114,39 @@ func NewSyslogHandler(message string) *SyslogHandler {
 	}
 }
 
+// newSyslogHandlerFromURL parses syslog:// with an optional message query
+// parameter
+func newSyslogHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	return NewSyslogHandler(queryMessage(u)), nil
+}
+
 // Handle sends a message to syslog with placeholders replaced
 func (h *SyslogHandler) Handle(exitCode int, output string) error {
-	// Replace placeholders
-	message := h.registry.Replace(h.message, exitCode, output)
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
 
-	// Connect to syslog
-	syslogWriter, err := syslog.New(syslog.LOG_ERR|syslog.LOG_USER, "failhook")
-	if err != nil {
-		return err
-	}
-	defer syslogWriter.Close()
+// HandleEvent sends a message to syslog with placeholders replaced
+func (h *SyslogHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
 
-	// Send message
-	return syslogWriter.Err(message)
+// HandleEventContext sends a message to syslog with placeholders replaced, giving up when ctx is done
+func (h *SyslogHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	// Replace placeholders
+	message := h.registry.ReplaceEvent(h.message, event)
+
+	// The syslog package cannot be canceled, so give up waiting instead
+	return runContext(ctx, func() error {
+		// Connect to syslog
+		syslogWriter, err := syslog.New(syslog.LOG_ERR|syslog.LOG_USER, "failhook")
+		if err != nil {
+			return err
+		}
+		defer syslogWriter.Close()
+
+		// Send message
+		return syslogWriter.Err(message)
+	})
 }
 
 // Description returns a description of the handler
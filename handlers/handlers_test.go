@@ -4,49 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
 )
 
-func TestCommandHandler(t *testing.T) {
-	// Create a temporary file to store command output
-	tmpFile, err := os.CreateTemp("", "command_test")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	tmpFile.Close()
-
-	// Test command that writes output to the temp file
-	handler := NewCommandHandler(fmt.Sprintf("echo 'Exit code: __STATUS_CODE__, Output: __OUTPUT__' > %s", tmpFile.Name()))
-
-	// Execute the handler
-	exitCode := 42
-	output := "test output"
-	err = handler.Handle(exitCode, output)
-	if err != nil {
-		t.Fatalf("Handler.Handle failed: %v", err)
-	}
-
-	// Verify the command was executed correctly
-	content, err := os.ReadFile(tmpFile.Name())
-	if err != nil {
-		t.Fatalf("Failed to read temp file: %v", err)
-	}
-
-	expectedContent := fmt.Sprintf("Exit code: %d, Output: %s\n", exitCode, output)
-	if string(content) != expectedContent {
-		t.Errorf("handler output = %q, want %q", string(content), expectedContent)
-	}
-
-	// Test description
-	desc := handler.Description()
-	if !strings.Contains(desc, "Execute command") {
-		t.Errorf("Description %q does not contain 'Execute command'", desc)
-	}
-}
-
 func TestWebhookHandler(t *testing.T) {
 	// Create a test server
 	var receivedURL string
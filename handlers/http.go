@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPHandler sends an HTTP request with a templated body on failure
+type HTTPHandler struct {
+	url             string
+	method          string
+	headers         [][2]string
+	body            string
+	contentType     string
+	username        string
+	password        string
+	bearerToken     string
+	successStatuses []int
+	signer          *Signer
+	registry        *PlaceholderRegistry
+}
+
+// NewHTTPHandler creates a new HTTPHandler for the specified URL. Without
+// options it sends a GET request and treats any 2xx status as success.
+func NewHTTPHandler(targetURL string, options ...func(*HTTPHandler)) *HTTPHandler {
+	handler := &HTTPHandler{
+		url:      targetURL,
+		registry: NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithMethod sets the request method. The default is POST when a body is set
+// and GET otherwise.
+func WithMethod(method string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.method = strings.ToUpper(method)
+	}
+}
+
+// WithHeader adds a request header. The value may contain placeholders.
+func WithHeader(name, value string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.headers = append(h.headers, [2]string{name, value})
+	}
+}
+
+// WithBody sets the request body template. Placeholder values are escaped
+// for the content type, which defaults to application/json.
+func WithBody(body string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.body = body
+	}
+}
+
+// WithContentType sets the Content-Type of the request body
+func WithContentType(contentType string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.contentType = contentType
+	}
+}
+
+// WithBasicAuth authenticates the request with HTTP basic authentication
+func WithBasicAuth(username, password string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.username = username
+		h.password = password
+	}
+}
+
+// WithBearerToken authenticates the request with a bearer token
+func WithBearerToken(token string) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.bearerToken = token
+	}
+}
+
+// WithSuccessStatus sets the response status codes that count as success
+// instead of any 2xx status
+func WithSuccessStatus(codes ...int) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.successStatuses = codes
+	}
+}
+
+// WithSigner signs every request and its body with signer
+func WithSigner(signer *Signer) func(*HTTPHandler) {
+	return func(h *HTTPHandler) {
+		h.signer = signer
+	}
+}
+
+// Handle sends the request with placeholders replaced
+func (h *HTTPHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent sends the request with placeholders replaced
+func (h *HTTPHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext sends the request with placeholders replaced, giving up when ctx is done
+func (h *HTTPHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	req, err := h.NewRequest(event)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if !h.isSuccess(resp.StatusCode) {
+		return NewHTTPStatusError(req.Method+" "+h.url, resp)
+	}
+	return nil
+}
+
+// NewRequest builds the request sent for event
+func (h *HTTPHandler) NewRequest(event *FailureEvent) (*http.Request, error) {
+	var body []byte
+	var bodyReader io.Reader
+	contentType := h.contentType
+	if h.body != "" {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		body = []byte(h.registry.ReplaceEventForContentType(h.body, event, contentType))
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(h.Method(), h.registry.ReplaceEventURLEncoded(h.url, event), bodyReader)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("error creating HTTP request: %v", err))
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, header := range h.headers {
+		// Header values must stay on one line
+		value := strings.Join(strings.Fields(h.registry.ReplaceEvent(header[1], event)), " ")
+		req.Header.Add(header[0], value)
+	}
+	switch {
+	case h.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+h.bearerToken)
+	case h.username != "" || h.password != "":
+		req.SetBasicAuth(h.username, h.password)
+	}
+	if h.signer != nil {
+		h.signer.SignRequest(req, body)
+	}
+
+	return req, nil
+}
+
+// Method returns the request method
+func (h *HTTPHandler) Method() string {
+	switch {
+	case h.method != "":
+		return h.method
+	case h.body != "":
+		return http.MethodPost
+	default:
+		return http.MethodGet
+	}
+}
+
+// isSuccess reports whether a response status counts as success
+func (h *HTTPHandler) isSuccess(status int) bool {
+	if len(h.successStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range h.successStatuses {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Description returns a description of the handler
+func (h *HTTPHandler) Description() string {
+	return fmt.Sprintf("Send HTTP request: %s %s", h.Method(), h.url)
+}
+
+// ContentTypeEscaper returns the escaping for placeholder values inserted
+// into a body of the given content type: JSON string escaping for JSON, query
+// escaping for form data, HTML escaping for HTML and XML, and none otherwise
+func ContentTypeEscaper(contentType string) func(string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return JSONEscape
+	case mediaType == "application/x-www-form-urlencoded":
+		return url.QueryEscape
+	case mediaType == "text/html" || mediaType == "text/xml" || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return html.EscapeString
+	}
+	return nil
+}
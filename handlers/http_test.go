@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPHandlerJSONBody(t *testing.T) {
+	var (
+		method, contentType, auth, custom, query string
+		body                                     []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		auth = r.Header.Get("Authorization")
+		custom = r.Header.Get("X-Exit-Code")
+		query = r.URL.Query().Get("code")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	handler := NewHTTPHandler(server.URL+"/alerts?code=__STATUS_CODE__",
+		WithHeader("X-Exit-Code", "__STATUS_CODE__"),
+		WithBody(`{"code": __STATUS_CODE__, "output": "__OUTPUT__"}`),
+		WithBearerToken("s3cret"))
+	if err := handler.Handle(2, "line \"one\"\nline two"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if method != "POST" {
+		t.Errorf("method = %q, want POST", method)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if auth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if custom != "2" || query != "2" {
+		t.Errorf("header, query = %q, %q, want 2, 2", custom, query)
+	}
+
+	var payload struct {
+		Code   int    `json:"code"`
+		Output string `json:"output"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("body is not valid JSON: %v\n%s", err, body)
+	}
+	if payload.Code != 2 || payload.Output != "line \"one\"\nline two" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestHTTPHandlerFormBodyAndBasicAuth(t *testing.T) {
+	var (
+		output, method string
+		user, pass     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		r.ParseForm()
+		output = r.PostForm.Get("output")
+		user, pass, _ = r.BasicAuth()
+	}))
+	defer server.Close()
+
+	handler := NewHTTPHandler(server.URL,
+		WithMethod("put"),
+		WithContentType("application/x-www-form-urlencoded"),
+		WithBody("output=__OUTPUT__&code=__STATUS_CODE__"),
+		WithBasicAuth("alice", "pw"))
+	if err := handler.Handle(1, "a&b=c d"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if method != "PUT" {
+		t.Errorf("method = %q, want PUT", method)
+	}
+	if output != "a&b=c d" {
+		t.Errorf("output = %q, want a&b=c d", output)
+	}
+	if user != "alice" || pass != "pw" {
+		t.Errorf("basic auth = %q:%q", user, pass)
+	}
+}
+
+func TestHTTPHandlerSuccessStatus(t *testing.T) {
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPHandler(server.URL).Handle(1, ""); err != nil {
+		t.Errorf("202 with default success statuses: %v", err)
+	}
+	if err := NewHTTPHandler(server.URL, WithSuccessStatus(200)).Handle(1, ""); err == nil {
+		t.Error("202 with success status 200: error = nil")
+	}
+
+	status = http.StatusConflict
+	if err := NewHTTPHandler(server.URL, WithSuccessStatus(200, 409)).Handle(1, ""); err != nil {
+		t.Errorf("409 with success statuses 200, 409: %v", err)
+	}
+	if err := NewHTTPHandler(server.URL).Handle(1, ""); err == nil {
+		t.Error("409 with default success statuses: error = nil")
+	}
+}
+
+func TestHTTPHandlerHeaderIsOneLine(t *testing.T) {
+	handler := NewHTTPHandler("https://example.com", WithHeader("X-Output", "__OUTPUT__"))
+	req, err := handler.NewRequest(NewFailureEvent(1, "one\r\nX-Evil: yes"))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if got := req.Header.Get("X-Output"); got != "one X-Evil: yes" {
+		t.Errorf("X-Output = %q", got)
+	}
+	if req.Method != "GET" {
+		t.Errorf("method = %q, want GET without a body", req.Method)
+	}
+}
+
+func TestContentTypeEscaper(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"application/json", `a\"b<`},
+		{"application/vnd.api+json; charset=utf-8", `a\"b<`},
+		{"application/x-www-form-urlencoded", "a%22b%3C"},
+		{"text/html", "a&#34;b&lt;"},
+		{"application/atom+xml", "a&#34;b&lt;"},
+		{"text/plain", `a"b<`},
+	}
+	for _, tt := range tests {
+		got := `a"b<`
+		if fn := ContentTypeEscaper(tt.contentType); fn != nil {
+			got = fn(got)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterScheme("mailto", newMailHandlerFromURL)
+}
+
+// DefaultMailSubject is the subject of mails that do not set one
+const DefaultMailSubject = "[failhook] __COMMAND__ __SUMMARY__"
+
+// MailHandler sends an email through an SMTP server on failure
+type MailHandler struct {
+	smtpAddr string
+	from     string
+	to       []string
+	subject  string
+	body     string
+	auth     smtp.Auth
+	registry *PlaceholderRegistry
+}
+
+// NewMailHandler creates a new MailHandler sending to the given recipients
+// through the SMTP server at smtpAddr (host:port)
+func NewMailHandler(smtpAddr string, to []string, subject, body string, options ...func(*MailHandler)) *MailHandler {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+
+	handler := &MailHandler{
+		smtpAddr: smtpAddr,
+		from:     "failhook@" + hostname,
+		to:       to,
+		subject:  subject,
+		body:     body,
+		registry: NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithMailFrom sets the sender address
+func WithMailFrom(from string) func(*MailHandler) {
+	return func(h *MailHandler) {
+		h.from = from
+	}
+}
+
+// WithMailAuth sets PLAIN credentials for the SMTP server
+func WithMailAuth(username, password string) func(*MailHandler) {
+	return func(h *MailHandler) {
+		host, _, err := net.SplitHostPort(h.smtpAddr)
+		if err != nil {
+			host = h.smtpAddr
+		}
+		h.auth = smtp.PlainAuth("", username, password, host)
+	}
+}
+
+// newMailHandlerFromURL parses mailto:ADDR[,ADDR...] with optional subject,
+// body (or message), from, smtp (host:port, default localhost:25), username
+// and password query parameters
+func newMailHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	var to []string
+	for _, addr := range strings.Split(u.Opaque, ",") {
+		if addr, err := url.PathUnescape(strings.TrimSpace(addr)); err == nil && addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf("mailto URL must name at least one recipient")
+	}
+
+	query := u.Query()
+	smtpAddr := query.Get("smtp")
+	if smtpAddr == "" {
+		smtpAddr = "localhost:25"
+	}
+	subject := query.Get("subject")
+	if subject == "" {
+		subject = DefaultMailSubject
+	}
+	body := query.Get("body")
+	if body == "" {
+		body = queryMessage(u)
+	}
+
+	var options []func(*MailHandler)
+	if from := query.Get("from"); from != "" {
+		options = append(options, WithMailFrom(from))
+	}
+	if username := query.Get("username"); username != "" {
+		options = append(options, WithMailAuth(username, query.Get("password")))
+	}
+	return NewMailHandler(smtpAddr, to, subject, body, options...), nil
+}
+
+// Handle sends the mail with placeholders replaced
+func (h *MailHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent sends the mail with placeholders replaced
+func (h *MailHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext sends the mail with placeholders replaced, giving up when ctx is done
+func (h *MailHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	// Header values must stay on one line
+	subject := strings.Join(strings.Fields(h.registry.ReplaceEvent(h.subject, event)), " ")
+	body := h.registry.ReplaceEvent(h.body, event)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", h.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(h.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := h.send(ctx, []byte(msg.String())); err != nil {
+		return fmt.Errorf("error sending mail: %w", err)
+	}
+	return nil
+}
+
+// send delivers msg like smtp.SendMail, closing the connection when ctx is
+// done
+func (h *MailHandler) send(ctx context.Context, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", h.smtpAddr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, err := net.SplitHostPort(h.smtpAddr)
+	if err != nil {
+		host = h.smtpAddr
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if h.auth != nil {
+		if err := c.Auth(h.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(h.from); err != nil {
+		return err
+	}
+	for _, addr := range h.to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Description returns a description of the handler
+func (h *MailHandler) Description() string {
+	return fmt.Sprintf("Send mail to %s via %s", strings.Join(h.to, ", "), h.smtpAddr)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts a single SMTP session and returns the envelope
+// recipients and message data it received
+func fakeSMTPServer(t *testing.T) (string, <-chan []string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	rcpts := make(chan []string, 1)
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var to []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				to = append(to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 Go ahead")
+				var msg strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					msg.WriteString(l)
+				}
+				rcpts <- to
+				data <- msg.String()
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), rcpts, data
+}
+
+func TestMailHandler(t *testing.T) {
+	addr, rcpts, data := fakeSMTPServer(t)
+
+	handler := NewMailHandler(addr, []string{"ops@example.com", "dev@example.com"},
+		"backup failed: __STATUS_CODE__", "exit __STATUS_CODE__\n__OUTPUT__",
+		WithMailFrom("cron@example.com"))
+	if err := handler.Handle(4, "no space left"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if got := strings.Join(<-rcpts, " "); got != "ops@example.com dev@example.com" {
+		t.Errorf("recipients = %q", got)
+	}
+	msg := <-data
+	for _, want := range []string{
+		"From: cron@example.com\r\n",
+		"To: ops@example.com, dev@example.com\r\n",
+		"Subject: backup failed: 4\r\n",
+		"\r\n\r\nexit 4\r\nno space left\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestMailHandlerSubjectIsOneLine(t *testing.T) {
+	addr, _, data := fakeSMTPServer(t)
+
+	handler := NewMailHandler(addr, []string{"ops@example.com"}, "failed: __OUTPUT__", "body")
+	if err := handler.Handle(1, "line one\nBcc: evil@example.com"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	msg := <-data
+	if !strings.Contains(msg, "Subject: failed: line one Bcc: evil@example.com\r\n") {
+		t.Errorf("subject was not folded onto one line:\n%s", msg)
+	}
+}
+
+func TestMailHandlerCanceled(t *testing.T) {
+	// A server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	handler := NewMailHandler(ln.Addr().String(), []string{"ops@example.com"}, "subject", "body")
+	if err := handler.HandleEventContext(ctx, NewFailureEvent(1, "")); err == nil {
+		t.Error("error = nil, want the stalled delivery to be abandoned")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+}
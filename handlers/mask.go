@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaskedValue replaces secret values in masked arguments
+const MaskedValue = "****"
+
+// DefaultSecretPatterns match arguments that usually carry credentials
+var DefaultSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)pass(word|wd)?`),
+	regexp.MustCompile(`(?i)secret`),
+	regexp.MustCompile(`(?i)token`),
+	regexp.MustCompile(`(?i)api[_-]?key`),
+	regexp.MustCompile(`(?i)credential`),
+	// Only the auth option itself, not --author or --no-auth
+	regexp.MustCompile(`(?i)^-*(auth|authorization)([=:]|$)`),
+}
+
+// MaskArgs returns a copy of args with secrets hidden. For every argument
+// matching one of patterns:
+//
+//   - "--name=value" and "name=value" keep the name and mask the value
+//   - a flag such as "--password" masks the argument that follows it
+//   - any other argument is masked entirely
+func MaskArgs(args []string, patterns []*regexp.Regexp) []string {
+	masked := make([]string, len(args))
+	copy(masked, args)
+
+	for i := 0; i < len(masked); i++ {
+		arg := args[i]
+		if !matchesAny(arg, patterns) {
+			continue
+		}
+
+		switch {
+		case strings.Contains(arg, "="):
+			name := arg[:strings.Index(arg, "=")]
+			masked[i] = name + "=" + MaskedValue
+		case strings.HasPrefix(arg, "-"):
+			if i+1 < len(masked) {
+				masked[i+1] = MaskedValue
+				i++
+			}
+		default:
+			masked[i] = MaskedValue
+		}
+	}
+
+	return masked
+}
+
+// matchesAny reports whether s matches at least one of patterns
+func matchesAny(s string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMaskArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		patterns []*regexp.Regexp
+		want     []string
+	}{
+		{
+			name:     "name=value",
+			args:     []string{"--user=admin", "--password=hunter2"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"--user=admin", "--password=****"},
+		},
+		{
+			name:     "flag followed by value",
+			args:     []string{"-v", "--token", "abc123", "deploy"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"-v", "--token", "****", "deploy"},
+		},
+		{
+			name:     "flag at the end",
+			args:     []string{"deploy", "--api-key"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"deploy", "--api-key"},
+		},
+		{
+			name:     "whole argument",
+			args:     []string{"mysql://root:secret@db/app"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"****"},
+		},
+		{
+			name:     "auth flag",
+			args:     []string{"--auth", "admin:hunter2", "--authorization=Bearer abc", "Authorization: Bearer abc"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"--auth", "****", "--authorization=****", "****"},
+		},
+		{
+			name:     "auth in other names",
+			args:     []string{"--author", "x", "--oauth-scopes", "repo"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"--author", "x", "--oauth-scopes", "repo"},
+		},
+		{
+			name:     "boolean flag followed by an argument",
+			args:     []string{"--no-auth", "build.sh"},
+			patterns: DefaultSecretPatterns,
+			want:     []string{"--no-auth", "build.sh"},
+		},
+		{
+			name:     "custom pattern",
+			args:     []string{"backup", "s3://bucket/key"},
+			patterns: []*regexp.Regexp{regexp.MustCompile(`^s3://`)},
+			want:     []string{"backup", "****"},
+		},
+		{
+			name:     "no patterns",
+			args:     []string{"--password=hunter2"},
+			patterns: nil,
+			want:     []string{"--password=hunter2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaskArgs(tt.args, tt.patterns)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MaskArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The original arguments are left untouched
+	args := []string{"--password=hunter2"}
+	MaskArgs(args, DefaultSecretPatterns)
+	if args[0] != "--password=hunter2" {
+		t.Errorf("MaskArgs modified its input: %q", args)
+	}
+}
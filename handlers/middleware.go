@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// EventFilter decides whether a handler runs for an event
+type EventFilter func(event *FailureEvent) bool
+
+// ExitCodeFilter matches events with one of the given exit codes
+func ExitCodeFilter(codes ...int) EventFilter {
+	return func(event *FailureEvent) bool {
+		for _, code := range codes {
+			if event.ExitCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// OutputFilter matches events whose output matches re
+func OutputFilter(re *regexp.Regexp) EventFilter {
+	return func(event *FailureEvent) bool {
+		return re.MatchString(event.Output)
+	}
+}
+
+// ChangedFilter matches events whose outcome differs from the previous
+// run's, so that a handler runs only when a job starts failing or recovers
+func ChangedFilter() EventFilter {
+	return func(event *FailureEvent) bool {
+		return event.Changed()
+	}
+}
+
+// AllFilters matches events that every filter matches
+func AllFilters(filters ...EventFilter) EventFilter {
+	return func(event *FailureEvent) bool {
+		for _, filter := range filters {
+			if !filter(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterHandler runs a handler only for events its filter matches
+type FilterHandler struct {
+	handler EventHandler
+	filter  EventFilter
+}
+
+// WithFilter returns handler run only for events filter matches. Other
+// events are ignored without an error.
+func WithFilter(handler EventHandler, filter EventFilter) *FilterHandler {
+	return &FilterHandler{
+		handler: handler,
+		filter:  filter,
+	}
+}
+
+// HandleEventContext runs the wrapped handler if the filter matches event
+func (h *FilterHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	if !h.filter(event) {
+		return nil
+	}
+	return AdaptContext(h.handler).HandleEventContext(ctx, event)
+}
+
+// Handle runs the wrapped handler if the filter matches
+func (h *FilterHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent runs the wrapped handler if the filter matches event
+func (h *FilterHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// Description returns the description of the wrapped handler
+func (h *FilterHandler) Description() string {
+	return h.handler.Description()
+}
+
+// Unwrap returns the wrapped handler
+func (h *FilterHandler) Unwrap() EventHandler {
+	return h.handler
+}
+
+// FallbackHandler runs a second handler when the first one fails, e.g. to
+// write to syslog when Slack cannot be reached
+type FallbackHandler struct {
+	handler  EventHandler
+	fallback EventHandler
+}
+
+// WithFallback returns handler with fallback run whenever handler fails.
+//
+// FallbackHandler does not implement Unwrapper: a default timeout or retry
+// policy applied to it covers the fallback as well.
+func WithFallback(handler, fallback EventHandler) *FallbackHandler {
+	return &FallbackHandler{
+		handler:  handler,
+		fallback: fallback,
+	}
+}
+
+// HandleEventContext runs the wrapped handler and, if it fails, the fallback.
+// It fails only if both do.
+func (h *FallbackHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	err := AdaptContext(h.handler).HandleEventContext(ctx, event)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if fallbackErr := AdaptContext(h.fallback).HandleEventContext(ctx, event); fallbackErr != nil {
+		return errors.Join(err, fmt.Errorf("fallback %s: %w", h.fallback.Description(), fallbackErr))
+	}
+	return nil
+}
+
+// Handle runs the wrapped handler and, if it fails, the fallback
+func (h *FallbackHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent runs the wrapped handler and, if it fails, the fallback
+func (h *FallbackHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// Description describes the wrapped handler and its fallback
+func (h *FallbackHandler) Description() string {
+	return fmt.Sprintf("%s (fallback: %s)", h.handler.Description(), h.fallback.Description())
+}
+
+// Primary returns the handler that runs first
+func (h *FallbackHandler) Primary() EventHandler {
+	return h.handler
+}
+
+// Fallback returns the handler that runs when the primary handler fails
+func (h *FallbackHandler) Fallback() EventHandler {
+	return h.fallback
+}
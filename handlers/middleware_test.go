@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// countingHandler counts its calls and fails with err
+type countingHandler struct {
+	name  string
+	calls int
+	err   error
+}
+
+func (h *countingHandler) HandleEvent(event *FailureEvent) error {
+	h.calls++
+	return h.err
+}
+
+func (h *countingHandler) Description() string {
+	return h.name
+}
+
+func TestWithFilter(t *testing.T) {
+	inner := &countingHandler{name: "inner"}
+	filter := AllFilters(ExitCodeFilter(1, 2), OutputFilter(regexp.MustCompile("(?i)error")))
+	handler := WithFilter(inner, filter)
+
+	tests := []struct {
+		exitCode int
+		output   string
+		want     int
+	}{
+		{1, "ERROR: disk full", 1},
+		{2, "an error", 2},
+		{3, "an error", 2},
+		{1, "all good", 2},
+	}
+	for _, tt := range tests {
+		if err := handler.HandleEvent(NewFailureEvent(tt.exitCode, tt.output)); err != nil {
+			t.Errorf("HandleEvent(%d, %q) failed: %v", tt.exitCode, tt.output, err)
+		}
+		if inner.calls != tt.want {
+			t.Errorf("after (%d, %q): calls = %d, want %d", tt.exitCode, tt.output, inner.calls, tt.want)
+		}
+	}
+	if handler.Description() != "inner" || handler.Unwrap() != EventHandler(inner) {
+		t.Errorf("FilterHandler does not describe and unwrap to the inner handler")
+	}
+}
+
+func TestWithFallback(t *testing.T) {
+	primary := &countingHandler{name: "primary"}
+	fallback := &countingHandler{name: "fallback"}
+	handler := WithFallback(primary, fallback)
+
+	if err := handler.HandleEvent(NewFailureEvent(1, "")); err != nil || fallback.calls != 0 {
+		t.Errorf("fallback ran for a successful handler: err = %v, calls = %d", err, fallback.calls)
+	}
+
+	primary.err = errors.New("unreachable")
+	if err := handler.HandleEvent(NewFailureEvent(1, "")); err != nil || fallback.calls != 1 {
+		t.Errorf("fallback did not replace the failed handler: err = %v, calls = %d", err, fallback.calls)
+	}
+
+	fallback.err = errors.New("also down")
+	err := handler.HandleEvent(NewFailureEvent(1, ""))
+	if err == nil || !strings.Contains(err.Error(), "unreachable") || !strings.Contains(err.Error(), "fallback fallback: also down") {
+		t.Errorf("error = %v, want both failures", err)
+	}
+	if got := handler.Description(); got != "primary (fallback: fallback)" {
+		t.Errorf("Description() = %q", got)
+	}
+}
+
+func TestFallbackIsNotUnwrapped(t *testing.T) {
+	handler := WithFallback(WithTimeout(&countingHandler{}, 0), &countingHandler{})
+	if HasTimeout(WithFilter(handler, ExitCodeFilter(1))) {
+		t.Error("HasTimeout looked through the fallback handler")
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultNotifyMessage is the message sent by handlers created from
+// notification URLs that do not set one
+const DefaultNotifyMessage = "__COMMAND__ __SUMMARY__ on __HOSTNAME__\n__OUTPUT_TAIL__"
+
+// SchemeFactory creates a failure handler from a notification URL such as
+// slack://T000/B000/XXXX or ntfy://ntfy.sh/alerts
+type SchemeFactory func(u *url.URL) (FailureHandler, error)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = make(map[string]SchemeFactory)
+)
+
+// RegisterScheme makes a notification URL scheme available to
+// NewHandlerFromURL. Handlers outside this package can register their own
+// schemes, typically from an init function. Registering a scheme twice
+// replaces the earlier factory.
+func RegisterScheme(scheme string, factory SchemeFactory) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	schemes[strings.ToLower(scheme)] = factory
+}
+
+// Schemes returns the registered notification URL schemes in sorted order
+func Schemes() []string {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	names := make([]string, 0, len(schemes))
+	for scheme := range schemes {
+		names = append(names, scheme)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewHandlerFromURL creates a failure handler from a notification URL using
+// the factory registered for its scheme
+func NewHandlerFromURL(rawURL string) (FailureHandler, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification URL: %v", err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("notification URL %q has no scheme", rawURL)
+	}
+
+	schemesMu.RLock()
+	factory, ok := schemes[strings.ToLower(u.Scheme)]
+	schemesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notification scheme %q (want one of %s)", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	return factory(u)
+}
+
+// queryMessage returns the message query parameter of u, or the default
+// notification message
+func queryMessage(u *url.URL) string {
+	if message := u.Query().Get("message"); message != "" {
+		return message
+	}
+	return DefaultNotifyMessage
+}
+
+// pathSegments returns the non-empty segments of the host and path of u
+func pathSegments(u *url.URL) []string {
+	var segments []string
+	for _, s := range strings.Split(u.Host+"/"+u.Path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	RegisterScheme("ntfy", newNtfyHandlerFromURL)
+}
+
+// NtfyHandler publishes a message to an ntfy topic on failure
+type NtfyHandler struct {
+	topicURL string
+	message  string
+	title    string
+	priority string
+	tags     string
+	username string
+	password string
+	registry *PlaceholderRegistry
+}
+
+// NewNtfyHandler creates a new NtfyHandler publishing to topicURL, e.g.
+// https://ntfy.sh/alerts
+func NewNtfyHandler(topicURL, message string, options ...func(*NtfyHandler)) *NtfyHandler {
+	handler := &NtfyHandler{
+		topicURL: topicURL,
+		message:  message,
+		registry: NewPlaceholderRegistry(),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// WithNtfyTitle sets the notification title, which may contain placeholders
+func WithNtfyTitle(title string) func(*NtfyHandler) {
+	return func(h *NtfyHandler) {
+		h.title = title
+	}
+}
+
+// WithNtfyPriority sets the notification priority (1-5 or min, low, default, high, max)
+func WithNtfyPriority(priority string) func(*NtfyHandler) {
+	return func(h *NtfyHandler) {
+		h.priority = priority
+	}
+}
+
+// WithNtfyTags sets the comma-separated notification tags
+func WithNtfyTags(tags string) func(*NtfyHandler) {
+	return func(h *NtfyHandler) {
+		h.tags = tags
+	}
+}
+
+// WithNtfyAuth sets the credentials for a protected topic
+func WithNtfyAuth(username, password string) func(*NtfyHandler) {
+	return func(h *NtfyHandler) {
+		h.username = username
+		h.password = password
+	}
+}
+
+// newNtfyHandlerFromURL parses ntfy://[user:password@]host/topic with
+// optional message, title, priority, tags and scheme (https or http) query
+// parameters
+func newNtfyHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" {
+		return nil, fmt.Errorf("ntfy URL must look like ntfy://HOST/TOPIC")
+	}
+
+	query := u.Query()
+	scheme := query.Get("scheme")
+	if scheme == "" {
+		scheme = "https"
+	}
+	if scheme != "https" && scheme != "http" {
+		return nil, fmt.Errorf("ntfy scheme must be https or http, not %q", scheme)
+	}
+
+	var options []func(*NtfyHandler)
+	if title := query.Get("title"); title != "" {
+		options = append(options, WithNtfyTitle(title))
+	}
+	if priority := query.Get("priority"); priority != "" {
+		options = append(options, WithNtfyPriority(priority))
+	}
+	if tags := query.Get("tags"); tags != "" {
+		options = append(options, WithNtfyTags(tags))
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		options = append(options, WithNtfyAuth(u.User.Username(), password))
+	}
+
+	topicURL := fmt.Sprintf("%s://%s/%s", scheme, u.Host, topic)
+	return NewNtfyHandler(topicURL, queryMessage(u), options...), nil
+}
+
+// Handle publishes a message to ntfy with placeholders replaced
+func (h *NtfyHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent publishes a message to ntfy with placeholders replaced
+func (h *NtfyHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext publishes a message to ntfy with placeholders replaced, giving up when ctx is done
+func (h *NtfyHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	message := h.registry.ReplaceEvent(h.message, event)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.topicURL, strings.NewReader(message))
+	if err != nil {
+		return Permanent(fmt.Errorf("error creating ntfy request: %v", err))
+	}
+	if h.title != "" {
+		// Output spanning lines would make the header invalid
+		req.Header.Set("Title", strings.Join(strings.Fields(h.registry.ReplaceEvent(h.title, event)), " "))
+	}
+	if h.priority != "" {
+		req.Header.Set("Priority", h.priority)
+	}
+	if h.tags != "" {
+		req.Header.Set("Tags", h.tags)
+	}
+	if h.username != "" || h.password != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending ntfy message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return NewHTTPStatusError("ntfy", resp)
+	}
+
+	return nil
+}
+
+// Description returns a description of the handler
+func (h *NtfyHandler) Description() string {
+	return fmt.Sprintf("Send to ntfy: %s", h.topicURL)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNtfyHandler(t *testing.T) {
+	var body, title, priority, tags, path string
+	var user, pass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		path = r.URL.Path
+		title = r.Header.Get("Title")
+		priority = r.Header.Get("Priority")
+		tags = r.Header.Get("Tags")
+		user, pass, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler := NewNtfyHandler(server.URL+"/alerts", "exit __STATUS_CODE__: __OUTPUT__",
+		WithNtfyTitle("failhook __STATUS_CODE__"),
+		WithNtfyPriority("high"),
+		WithNtfyTags("warning,cron"),
+		WithNtfyAuth("alice", "secret"))
+	if err := handler.Handle(3, "oops"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+
+	if path != "/alerts" {
+		t.Errorf("path = %q, want /alerts", path)
+	}
+	if body != "exit 3: oops" {
+		t.Errorf("body = %q", body)
+	}
+	if title != "failhook 3" || priority != "high" || tags != "warning,cron" {
+		t.Errorf("title, priority, tags = %q, %q, %q", title, priority, tags)
+	}
+	if user != "alice" || pass != "secret" {
+		t.Errorf("basic auth = %q:%q, want alice:secret", user, pass)
+	}
+}
+
+func TestNtfyHandlerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	handler := NewNtfyHandler(server.URL+"/alerts", "test")
+	if err := handler.Handle(1, "error"); err == nil {
+		t.Error("Expected error for 403 response, got nil")
+	}
+}
+
+func TestNtfyHandlerTitleIsOneLine(t *testing.T) {
+	var title string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.Header.Get("Title")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler := NewNtfyHandler(server.URL+"/alerts", "body", WithNtfyTitle("failed: __OUTPUT__"))
+	if err := handler.Handle(1, "line one\r\nline two\n"); err != nil {
+		t.Fatalf("Handler.Handle failed: %v", err)
+	}
+	if title != "failed: line one line two" {
+		t.Errorf("Title = %q, want the output on one line", title)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+)
+
+// Stream names used in OutputLine
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputLine is a single line of the monitored command's output
+type OutputLine struct {
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+}
+
+// FormatOutputLines joins lines in the order given. With tags each line is
+// prefixed with its stream name, and with timestamps with the time it was
+// received in RFC3339 format with millisecond precision.
+func FormatOutputLines(lines []OutputLine, tags, timestamps bool) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		if timestamps {
+			sb.WriteString(line.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+			sb.WriteByte(' ')
+		}
+		if tags {
+			sb.WriteString("[" + line.Stream + "] ")
+		}
+		sb.WriteString(line.Text)
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatOutputLines(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	lines := []OutputLine{
+		{Stream: StreamStdout, Time: at, Text: "starting"},
+		{Stream: StreamStderr, Time: at, Text: "error: disk full"},
+		{Stream: StreamStdout, Time: at, Text: "aborted"},
+	}
+
+	tests := []struct {
+		name       string
+		tags       bool
+		timestamps bool
+		want       string
+	}{
+		{
+			name: "plain",
+			want: "starting\nerror: disk full\naborted",
+		},
+		{
+			name: "tags",
+			tags: true,
+			want: "[stdout] starting\n[stderr] error: disk full\n[stdout] aborted",
+		},
+		{
+			name:       "tags and timestamps",
+			tags:       true,
+			timestamps: true,
+			want: "2025-01-02T03:04:05.006Z [stdout] starting\n" +
+				"2025-01-02T03:04:05.006Z [stderr] error: disk full\n" +
+				"2025-01-02T03:04:05.006Z [stdout] aborted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatOutputLines(lines, tt.tags, tt.timestamps)
+			if got != tt.want {
+				t.Errorf("FormatOutputLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,32 +3,37 @@ package handlers
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// DefaultTailLines is the number of lines returned by the *_TAIL__ placeholders
+const DefaultTailLines = 20
+
 // PlaceholderFunc defines a function that returns a string replacement for a placeholder
 type PlaceholderFunc func(exitCode int, output string) string
 
-// PlaceholderContext holds data about a command execution
-type PlaceholderContext struct {
-	ExitCode    int
-	Output      string
-	CommandName string
-	StartTime   time.Time
-	EndTime     time.Time
-	Duration    time.Duration
-}
+// EventPlaceholderFunc defines a function that returns a string replacement
+// for a placeholder using everything known about the failed run
+type EventPlaceholderFunc func(event *FailureEvent) string
 
-// PlaceholderRegistry manages available placeholders
+// PlaceholderRegistry manages available placeholders and the filters that
+// can be applied to them.
+//
+// Besides plain tokens such as __OUTPUT__, templates may use parameterized
+// expressions that pass the value through a chain of filters, either as
+// {{output | tail 40 | json}} or as __OUTPUT:tail=40,json__.
 type PlaceholderRegistry struct {
-	placeholders map[string]PlaceholderFunc
+	placeholders map[string]EventPlaceholderFunc
+	filters      map[string]filter
 }
 
 // NewPlaceholderRegistry creates a new registry with default placeholders
 func NewPlaceholderRegistry() *PlaceholderRegistry {
 	registry := &PlaceholderRegistry{
-		placeholders: make(map[string]PlaceholderFunc),
+		placeholders: make(map[string]EventPlaceholderFunc),
+		filters:      defaultFilters(),
 	}
 
 	// Register default placeholders
@@ -40,6 +45,117 @@ func NewPlaceholderRegistry() *PlaceholderRegistry {
 		return output
 	})
 	
+	registry.RegisterEvent("__STDOUT__", func(event *FailureEvent) string {
+		return strings.TrimSpace(event.Stdout)
+	})
+
+	registry.RegisterEvent("__STDERR__", func(event *FailureEvent) string {
+		return strings.TrimSpace(event.Stderr)
+	})
+
+	registry.Register("__OUTPUT_TAIL__", func(_ int, output string) string {
+		return TailLines(output, DefaultTailLines)
+	})
+
+	registry.RegisterEvent("__STDOUT_TAIL__", func(event *FailureEvent) string {
+		return TailLines(event.Stdout, DefaultTailLines)
+	})
+
+	registry.RegisterEvent("__STDERR_TAIL__", func(event *FailureEvent) string {
+		return TailLines(event.Stderr, DefaultTailLines)
+	})
+
+	registry.Register("__OUTPUT_SIZE__", func(_ int, output string) string {
+		return fmt.Sprintf("%d", len(output))
+	})
+
+	registry.RegisterEvent("__STDOUT_SIZE__", func(event *FailureEvent) string {
+		return fmt.Sprintf("%d", len(event.Stdout))
+	})
+
+	registry.RegisterEvent("__STDERR_SIZE__", func(event *FailureEvent) string {
+		return fmt.Sprintf("%d", len(event.Stderr))
+	})
+
+	registry.RegisterEvent("__DURATION__", func(event *FailureEvent) string {
+		return event.Duration.Round(time.Millisecond).String()
+	})
+
+	registry.RegisterEvent("__DURATION_SECONDS__", func(event *FailureEvent) string {
+		return strconv.FormatFloat(event.Duration.Seconds(), 'f', 3, 64)
+	})
+
+	registry.RegisterEvent("__START_TIME__", func(event *FailureEvent) string {
+		return formatEventTime(event.StartTime)
+	})
+
+	registry.RegisterEvent("__END_TIME__", func(event *FailureEvent) string {
+		return formatEventTime(event.EndTime)
+	})
+
+	registry.RegisterEvent("__COMMAND__", func(event *FailureEvent) string {
+		return event.Command
+	})
+
+	registry.RegisterEvent("__ARGS__", func(event *FailureEvent) string {
+		return strings.Join(event.Args, " ")
+	})
+
+	registry.RegisterEvent("__CWD__", func(event *FailureEvent) string {
+		return event.WorkingDir
+	})
+
+	registry.RegisterEvent("__USER__", func(event *FailureEvent) string {
+		return event.User
+	})
+
+	registry.RegisterEvent("__HOSTNAME__", func(event *FailureEvent) string {
+		return event.Hostname
+	})
+
+	registry.RegisterEvent("__FQDN__", func(event *FailureEvent) string {
+		return event.HostFQDN()
+	})
+
+	registry.RegisterEvent("__PID__", func(event *FailureEvent) string {
+		if event.PID == 0 {
+			return ""
+		}
+		return strconv.Itoa(event.PID)
+	})
+
+	registry.RegisterEvent("__ATTEMPTS__", func(event *FailureEvent) string {
+		return strconv.Itoa(event.AttemptCount())
+	})
+
+	registry.RegisterEvent("__ATTEMPT_EXIT_CODES__", func(event *FailureEvent) string {
+		return joinInts(event.AttemptExitCodes())
+	})
+
+	registry.RegisterEvent("__MATCH__", func(event *FailureEvent) string {
+		return event.Match
+	})
+
+	registry.RegisterEvent("__PHASE__", func(event *FailureEvent) string {
+		return event.Phase
+	})
+
+	registry.RegisterEvent("__OUTCOME__", func(event *FailureEvent) string {
+		return event.Outcome
+	})
+
+	registry.RegisterEvent("__SUMMARY__", func(event *FailureEvent) string {
+		return event.Summary()
+	})
+
+	registry.RegisterEvent("__CONSECUTIVE_FAILURES__", func(event *FailureEvent) string {
+		return strconv.Itoa(event.ConsecutiveFailures)
+	})
+
+	registry.RegisterEvent("__FAILING_SINCE__", func(event *FailureEvent) string {
+		return formatEventTime(event.FailingSince)
+	})
+
 	registry.Register("__TIMESTAMP__", func(_ int, _ string) string {
 		return time.Now().Format(time.RFC3339)
 	})
@@ -57,25 +173,84 @@ func NewPlaceholderRegistry() *PlaceholderRegistry {
 
 // Register adds a new placeholder to the registry
 func (pr *PlaceholderRegistry) Register(placeholder string, fn PlaceholderFunc) {
+	pr.placeholders[placeholder] = func(event *FailureEvent) string {
+		return fn(event.ExitCode, event.Output)
+	}
+}
+
+// RegisterEvent adds a new placeholder that needs more than the exit code
+// and combined output to the registry
+func (pr *PlaceholderRegistry) RegisterEvent(placeholder string, fn EventPlaceholderFunc) {
 	pr.placeholders[placeholder] = fn
 }
 
+// RegisterFilter adds a new filter to the registry
+func (pr *PlaceholderRegistry) RegisterFilter(name string, fn FilterFunc) {
+	pr.filters[name] = filter{fn: fn}
+}
+
 // Replace replaces all registered placeholders in the given text
 func (pr *PlaceholderRegistry) Replace(text string, exitCode int, output string) string {
-	result := text
-	for placeholder, fn := range pr.placeholders {
-		replacement := fn(exitCode, output)
-		result = strings.Replace(result, placeholder, replacement, -1)
-	}
-	return result
+	return pr.ReplaceEvent(text, NewFailureEvent(exitCode, output))
 }
 
 // ReplaceURLEncoded replaces all registered placeholders in the given text and URL-encodes their values
 func (pr *PlaceholderRegistry) ReplaceURLEncoded(text string, exitCode int, output string) string {
-	result := text
-	for placeholder, fn := range pr.placeholders {
-		replacement := url.QueryEscape(fn(exitCode, output))
-		result = strings.Replace(result, placeholder, replacement, -1)
+	return pr.ReplaceEventURLEncoded(text, NewFailureEvent(exitCode, output))
+}
+
+// ReplaceEvent replaces all registered placeholders in the given text using
+// the data in event
+func (pr *PlaceholderRegistry) ReplaceEvent(text string, event *FailureEvent) string {
+	return pr.render(text, event, nil)
+}
+
+// ReplaceEventURLEncoded replaces all registered placeholders in the given
+// text using the data in event and URL-encodes their values
+func (pr *PlaceholderRegistry) ReplaceEventURLEncoded(text string, event *FailureEvent) string {
+	return pr.render(text, event, funcEscaper(url.QueryEscape))
+}
+
+// ReplaceEventForContentType replaces all registered placeholders in a
+// request body of the given content type using the data in event. Values are
+// escaped as chosen by ContentTypeEscaper.
+func (pr *PlaceholderRegistry) ReplaceEventForContentType(text string, event *FailureEvent, contentType string) string {
+	if fn := ContentTypeEscaper(contentType); fn != nil {
+		return pr.render(text, event, funcEscaper(fn))
+	}
+	return pr.render(text, event, nil)
+}
+
+// ReplaceEventShell replaces all registered placeholders in the given shell
+// command with references to environment variables, and returns the command
+// with the FAILHOOK_EVENT_VALUE_<n> variables holding the values. The shell
+// never parses a value, so it reaches the command as literal text whether the
+// placeholder is unquoted, inside quotes or inside a command substitution.
+// Escaping filters such as shell and raw insert their result into the
+// command instead.
+func (pr *PlaceholderRegistry) ReplaceEventShell(text string, event *FailureEvent) (string, []string) {
+	esc := &shellEscaper{}
+	command := pr.render(text, event, esc)
+	return command, esc.env()
+}
+
+// formatEventTime formats t in RFC3339, or returns an empty string if t is unset
+func formatEventTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// TailLines returns the last n lines of text, ignoring trailing whitespace
+func TailLines(text string, n int) string {
+	text = strings.TrimRight(text, " \t\r\n")
+	if n <= 0 || text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
-	return result
+	return strings.Join(lines, "\n")
 }
\ No newline at end of file
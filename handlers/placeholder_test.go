@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPlaceholderRegistry(t *testing.T) {
@@ -72,6 +74,22 @@ func TestPlaceholderRegistry(t *testing.T) {
 	}
 }
 
+func TestReplaceEventShell(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := NewFailureEvent(2, "it's $(bad)")
+
+	command, env := registry.ReplaceEventShell(
+		`notify __OUTPUT__ 'code __STATUS_CODE__' "$(echo '__OUTPUT__')" {{output | raw}}`, event)
+	want := `notify "${FAILHOOK_EVENT_VALUE_1}" 'code '"${FAILHOOK_EVENT_VALUE_2}"'' "$(echo ''"${FAILHOOK_EVENT_VALUE_3}"'')" it's $(bad)`
+	if command != want {
+		t.Errorf("command = %q, want %q", command, want)
+	}
+	wantEnv := []string{"FAILHOOK_EVENT_VALUE_1=it's $(bad)", "FAILHOOK_EVENT_VALUE_2=2", "FAILHOOK_EVENT_VALUE_3=it's $(bad)"}
+	if strings.Join(env, "\n") != strings.Join(wantEnv, "\n") {
+		t.Errorf("env = %q, want %q", env, wantEnv)
+	}
+}
+
 func TestCustomPlaceholder(t *testing.T) {
 	registry := NewPlaceholderRegistry()
 	
@@ -102,6 +120,247 @@ func TestURLEncoding(t *testing.T) {
 	}
 }
 
+func TestStreamPlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{
+		ExitCode: 2,
+		Output:   "report ready\nerror: bad input",
+		Stdout:   "report ready\n",
+		Stderr:   "error: bad input\n",
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"__STDOUT__", "report ready"},
+		{"__STDERR__", "error: bad input"},
+		{"__STDOUT_SIZE__/__STDERR_SIZE__", "13/17"},
+		{"__OUTPUT_SIZE__", "29"},
+		{"__STDERR_TAIL__", "error: bad input"},
+		{"[__STATUS_CODE__] __STDERR__", "[2] error: bad input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := registry.ReplaceEvent(tt.text, event); got != tt.want {
+				t.Errorf("ReplaceEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimingPlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	start := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	event := &FailureEvent{
+		StartTime: start,
+		EndTime:   start.Add(90*time.Second + 250*time.Millisecond),
+		Duration:  90*time.Second + 250*time.Millisecond,
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"__DURATION__", "1m30.25s"},
+		{"__DURATION_SECONDS__", "90.250"},
+		{"__START_TIME__", "2025-03-04T05:06:07Z"},
+		{"__END_TIME__", "2025-03-04T05:07:37Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := registry.ReplaceEvent(tt.text, event); got != tt.want {
+				t.Errorf("ReplaceEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without run timing the times render empty
+	if got := registry.Replace("[__START_TIME__]", 1, ""); got != "[]" {
+		t.Errorf("Replace() = %q, want %q", got, "[]")
+	}
+}
+
+func TestRunPlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{
+		Command:    "backup --dest /srv",
+		Args:       []string{"--dest", "/srv"},
+		PID:        4242,
+		WorkingDir: "/home/ops",
+		User:       "ops",
+		Hostname:   "web1",
+		FQDN:       "web1.example.com",
+	}
+
+	got := registry.ReplaceEvent("__USER__@__HOSTNAME__ (__FQDN__) in __CWD__: __COMMAND__ [__ARGS__] pid __PID__", event)
+	want := "ops@web1 (web1.example.com) in /home/ops: backup --dest /srv [--dest /srv] pid 4242"
+	if got != want {
+		t.Errorf("ReplaceEvent() = %q, want %q", got, want)
+	}
+}
+
+func TestAttemptPlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+
+	event := NewFailureEvent(75, "")
+	if got := registry.ReplaceEvent("__ATTEMPTS__: __ATTEMPT_EXIT_CODES__", event); got != "1: 75" {
+		t.Errorf("ReplaceEvent() = %q for a single run, want %q", got, "1: 75")
+	}
+
+	event.Attempts = []Attempt{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 75}}
+	if got := registry.ReplaceEvent("{{attempts}}: {{attempt_exit_codes}}", event); got != "3: 1,1,75" {
+		t.Errorf("ReplaceEvent() = %q, want %q", got, "3: 1,1,75")
+	}
+}
+
+func TestMatchPlaceholder(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{Match: "FATAL: license expired"}
+	if got := registry.ReplaceEvent("matched: __MATCH__", event); got != "matched: FATAL: license expired" {
+		t.Errorf("ReplaceEvent() = %q", got)
+	}
+}
+
+func TestPhasePlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{Phase: PhaseFinish, Outcome: OutcomeSuccess}
+	if got := registry.ReplaceEvent("__PHASE__ __OUTCOME__: __SUMMARY__", event); got != "finish success: succeeded" {
+		t.Errorf("ReplaceEvent() = %q, want %q", got, "finish success: succeeded")
+	}
+}
+
+func TestStatePlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{ConsecutiveFailures: 3, FailingSince: time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)}
+	if got := registry.ReplaceEvent("__CONSECUTIVE_FAILURES__ since __FAILING_SINCE__", event); got != "3 since 2024-05-01T03:00:00Z" {
+		t.Errorf("ReplaceEvent() = %q, want %q", got, "3 since 2024-05-01T03:00:00Z")
+	}
+	if got := registry.ReplaceEvent("[__FAILING_SINCE__]", &FailureEvent{}); got != "[]" {
+		t.Errorf("ReplaceEvent() = %q without failures, want %q", got, "[]")
+	}
+}
+
+func TestPlaceholderExpressions(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{
+		ExitCode:  2,
+		Output:    "line 1\nline 2\nline \"3\"",
+		Stderr:    "fatal: it's broken\n",
+		StartTime: time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"brace without filters", "{{status_code}}", "2"},
+		{"brace with filters", "{{ output | tail 1 | json }}", `line \"3\"`},
+		{"brace with quoted argument", `{{start_time | format "2006-01-02 15:04"}}`, "2025-03-04 05:06"},
+		{"brace with time zone", "{{start_time | tz Asia/Tokyo | format Kitchen}}", "2:06PM"},
+		{"colon syntax", "__OUTPUT:tail=2__", "line 2\nline \"3\""},
+		{"colon syntax with chain", "__STDERR:trim,upper__", "FATAL: IT'S BROKEN"},
+		{"colon syntax with shell", "__STDERR:trim,shell__", `'fatal: it'\''s broken'`},
+		{"mixed with plain tokens", "code __STATUS_CODE__: {{output | head 1}}", "code 2: line 1"},
+		{"unknown placeholder left unchanged", "{{nothing}}", "{{nothing}}"},
+		{"unknown filter left unchanged", "{{output | sparkle}}", "{{output | sparkle}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.ReplaceEvent(tt.text, event); got != tt.want {
+				t.Errorf("ReplaceEvent(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceholderExpressionsURLEncoded(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	event := &FailureEvent{Output: "a b\nc d"}
+
+	// Values are URL-encoded by default
+	got := registry.ReplaceEventURLEncoded("https://example.com/?out={{output | tail 1}}", event)
+	if want := "https://example.com/?out=c+d"; got != want {
+		t.Errorf("ReplaceEventURLEncoded() = %q, want %q", got, want)
+	}
+
+	// An explicit escaping filter replaces the default encoding
+	got = registry.ReplaceEventURLEncoded("https://example.com/{{output | tail 1 | urlpath}}", event)
+	if want := "https://example.com/c%20d"; got != want {
+		t.Errorf("ReplaceEventURLEncoded() = %q, want %q", got, want)
+	}
+}
+
+func TestCustomFilter(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	registry.RegisterFilter("reverse", func(value string, args []string) (string, error) {
+		runes := []rune(value)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	})
+
+	if got := registry.Replace("{{output | reverse}}", 0, "abc"); got != "cba" {
+		t.Errorf("Replace() = %q, want %q", got, "cba")
+	}
+}
+
+func TestPlaceholderValidate(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+
+	valid := []string{
+		"plain __OUTPUT__ text",
+		"{{output | tail 40 | json}}",
+		"__STDERR:tail=5,html__",
+	}
+	for _, text := range valid {
+		if err := registry.Validate(text); err != nil {
+			t.Errorf("Validate(%q) = %v, want nil", text, err)
+		}
+	}
+
+	invalid := []string{
+		"{{nothing}}",
+		"{{output | sparkle}}",
+		"{{output | tail}}",
+		"{{output | tail many}}",
+		"__OUTPUT:tail=x__",
+		`{{output | format "unterminated}}`,
+	}
+	for _, text := range invalid {
+		if err := registry.Validate(text); err == nil {
+			t.Errorf("Validate(%q) = nil, want error", text)
+		}
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+		want string
+	}{
+		{"fewer lines than n", "a\nb", 5, "a\nb"},
+		{"more lines than n", "a\nb\nc\nd\n", 2, "c\nd"},
+		{"zero", "a\nb", 0, ""},
+		{"empty", "", 3, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TailLines(tt.text, tt.n); got != tt.want {
+				t.Errorf("TailLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 // HasPrefix is a helper function that checks if a string starts with a prefix
 func HasPrefix(s, prefix string) bool {
 	return len(s) >= len(prefix) && s[0:len(prefix)] == prefix
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RateLimitHandler runs a handler at most a number of times within a sliding
+// window and ignores the events beyond that, so that a command failing in a
+// loop does not flood the notification target
+type RateLimitHandler struct {
+	handler EventHandler
+	limit   int
+	window  time.Duration
+	// stateFile keeps the send times across processes; empty keeps them in
+	// memory
+	stateFile string
+
+	mu   sync.Mutex
+	sent []time.Time
+	now  func() time.Time
+	// errors receives the state file errors that are ignored
+	errors io.Writer
+}
+
+// WithRateLimit returns handler run for at most limit events per window
+func WithRateLimit(handler EventHandler, limit int, window time.Duration, options ...func(*RateLimitHandler)) *RateLimitHandler {
+	h := &RateLimitHandler{
+		handler: handler,
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		errors:  os.Stderr,
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	return h
+}
+
+// WithRateLimitFile keeps the times the handler ran in path, shared by every
+// process using the same file. The file is locked while it is updated.
+func WithRateLimitFile(path string) func(*RateLimitHandler) {
+	return func(h *RateLimitHandler) {
+		h.stateFile = path
+	}
+}
+
+// ParseRateLimit parses a rate limit such as "5/1h" or "1/m" into the number
+// of events and the window they are counted in
+func ParseRateLimit(value string) (int, time.Duration, error) {
+	count, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid rate limit %q (want COUNT/DURATION, e.g. 5/1h)", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("invalid rate limit count %q", count)
+	}
+	per = strings.TrimSpace(per)
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	window, err := time.ParseDuration(per)
+	if err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit window %q", per)
+	}
+	return limit, window, nil
+}
+
+// HandleEventContext runs the wrapped handler unless the limit is reached.
+// Every event that runs the handler counts against the limit, whether it
+// succeeds or not. If the state file cannot be used, the error is reported
+// on stderr and the handler runs, so that a read-only or full cache
+// directory does not suppress notifications.
+func (h *RateLimitHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	allowed, err := h.allow()
+	if err != nil {
+		fmt.Fprintf(h.errors, "Error with rate limit of handler %s: %v; running it anyway\n", h.Description(), err)
+		allowed = true
+	}
+	if !allowed {
+		return nil
+	}
+	return AdaptContext(h.handler).HandleEventContext(ctx, event)
+}
+
+// allow reports whether the handler may run now and records the run if so
+func (h *RateLimitHandler) allow() (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stateFile == "" {
+		var allowed bool
+		h.sent, allowed = h.record(h.sent)
+		return allowed, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.stateFile), 0700); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(h.stateFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return false, err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	var state rateLimitState
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return false, err
+	}
+	// A corrupt state file is treated as empty rather than blocking the
+	// notification forever
+	if len(data) > 0 && json.Unmarshal(data, &state) != nil {
+		state = rateLimitState{}
+	}
+
+	sent, allowed := h.record(state.Sent)
+	if !allowed {
+		return false, nil
+	}
+	data, err = json.Marshal(rateLimitState{Sent: sent})
+	if err != nil {
+		return false, err
+	}
+	if err := file.Truncate(0); err != nil {
+		return false, err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// record drops the send times that left the window and, if the limit is not
+// reached, appends the current time
+func (h *RateLimitHandler) record(sent []time.Time) ([]time.Time, bool) {
+	now := h.now()
+	recent := sent[:0]
+	for _, t := range sent {
+		if now.Sub(t) < h.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= h.limit {
+		return recent, false
+	}
+	return append(recent, now), true
+}
+
+// rateLimitState is the contents of a rate limit state file
+type rateLimitState struct {
+	Sent []time.Time `json:"sent"`
+}
+
+// Handle runs the wrapped handler unless the limit is reached
+func (h *RateLimitHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent runs the wrapped handler unless the limit is reached
+func (h *RateLimitHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// Description returns the description of the wrapped handler
+func (h *RateLimitHandler) Description() string {
+	return h.handler.Description()
+}
+
+// Unwrap returns the wrapped handler
+func (h *RateLimitHandler) Unwrap() EventHandler {
+	return h.handler
+}
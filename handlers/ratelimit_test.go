@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value  string
+		limit  int
+		window time.Duration
+		ok     bool
+	}{
+		{"5/1h", 5, time.Hour, true},
+		{"1/m", 1, time.Minute, true},
+		{"10 / 30s", 10, 30 * time.Second, true},
+		{"5", 0, 0, false},
+		{"0/1h", 0, 0, false},
+		{"5/soon", 0, 0, false},
+		{"5/-1h", 0, 0, false},
+	}
+	for _, tt := range tests {
+		limit, window, err := ParseRateLimit(tt.value)
+		if (err == nil) != tt.ok || limit != tt.limit || window != tt.window {
+			t.Errorf("ParseRateLimit(%q) = %d, %v, %v", tt.value, limit, window, err)
+		}
+	}
+}
+
+// fakeClock returns a settable clock for rate limit tests
+func fakeClock(h *RateLimitHandler) *time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	return &now
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	inner := &countingHandler{name: "inner"}
+	handler := WithRateLimit(inner, 2, time.Hour)
+	now := fakeClock(handler)
+
+	for i := 0; i < 3; i++ {
+		if err := handler.HandleEvent(NewFailureEvent(1, "")); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+		*now = now.Add(time.Minute)
+	}
+	if inner.calls != 2 {
+		t.Errorf("calls = %d, want 2 within the window", inner.calls)
+	}
+
+	*now = now.Add(time.Hour)
+	handler.HandleEvent(NewFailureEvent(1, ""))
+	if inner.calls != 3 {
+		t.Errorf("calls = %d, want 3 once the window passed", inner.calls)
+	}
+}
+
+func TestRateLimitFileIsShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "slack.json")
+	inner := &countingHandler{name: "inner"}
+
+	// Separate handlers stand in for separate failhook runs
+	for i := 0; i < 3; i++ {
+		if err := WithRateLimit(inner, 2, time.Hour, WithRateLimitFile(path)).HandleEvent(NewFailureEvent(1, "")); err != nil {
+			t.Fatalf("HandleEvent failed: %v", err)
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("calls = %d, want 2", inner.calls)
+	}
+
+	// A corrupt state file does not suppress notifications
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	WithRateLimit(inner, 2, time.Hour, WithRateLimitFile(path)).HandleEvent(NewFailureEvent(1, ""))
+	if inner.calls != 3 {
+		t.Errorf("calls = %d, want 3 after the state file was reset", inner.calls)
+	}
+}
+
+func TestRateLimitFileErrorRunsHandler(t *testing.T) {
+	// The state directory cannot be created below a regular file
+	blocker := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingHandler{name: "inner"}
+	handler := WithRateLimit(inner, 1, time.Hour, WithRateLimitFile(filepath.Join(blocker, "ratelimit", "slack.json")))
+	var stderr bytes.Buffer
+	handler.errors = &stderr
+
+	if err := handler.HandleEvent(NewFailureEvent(1, "")); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("calls = %d, want the handler to run despite the state file error", inner.calls)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("running it anyway")) {
+		t.Errorf("stderr = %q, want the state file error reported", stderr.String())
+	}
+}
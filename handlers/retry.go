@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// HTTPStatusError reports an HTTP response with an unexpected status
+type HTTPStatusError struct {
+	// Target names what was called, e.g. "slack API" or "POST https://..."
+	Target     string
+	StatusCode int
+	// RetryAfter is the delay requested by a Retry-After header, or 0
+	RetryAfter time.Duration
+}
+
+// NewHTTPStatusError creates an HTTPStatusError for resp
+func NewHTTPStatusError(target string, resp *http.Response) *HTTPStatusError {
+	return &HTTPStatusError{
+		Target:     target,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Error implements error
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s returned status code %d", e.Target, e.StatusCode)
+}
+
+// Retryable reports whether the request may succeed when repeated: rate
+// limiting (429), request timeouts (408) and server errors (5xx)
+func (e *HTTPStatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= 500
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning 0 if it is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// permanentError marks an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable reports whether a handler that failed with err may succeed if
+// run again. Network errors, timeouts, 429 and 5xx responses and temporary
+// SMTP replies are retryable; other HTTP 4xx responses, permanent SMTP
+// replies and errors marked with Permanent are not. Errors of unknown kind,
+// such as a failed hook command, are retried.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500
+	}
+	return true
+}
+
+// RetryPolicy configures how a RetryHandler repeats failed attempts
+type RetryPolicy struct {
+	// Retries is the number of attempts after the first one
+	Retries int
+	// InitialDelay is the wait before the first retry
+	InitialDelay time.Duration
+	// MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+	// Multiplier grows the delay after every retry
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction in either direction
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns a policy with the given number of retries,
+// starting at one second and doubling up to 30 seconds with 20% jitter
+func DefaultRetryPolicy(retries int) RetryPolicy {
+	return RetryPolicy{
+		Retries:      retries,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Delay returns the wait before retry number n, starting at 1
+func (p RetryPolicy) Delay(n int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(n-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// RetryHandler runs a handler again when it fails with a retryable error
+type RetryHandler struct {
+	handler EventHandler
+	policy  RetryPolicy
+	// sleep waits for d or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// WithRetry returns handler retried according to policy
+func WithRetry(handler EventHandler, policy RetryPolicy) *RetryHandler {
+	return &RetryHandler{
+		handler: handler,
+		policy:  policy,
+		sleep:   sleepContext,
+	}
+}
+
+// HandleEventContext runs the wrapped handler until it succeeds, fails with
+// a permanent error, runs out of retries or ctx is done. A Retry-After delay
+// requested by the endpoint replaces the computed backoff, but is capped at
+// the policy's MaxDelay so that an endpoint cannot hold failhook for hours.
+func (h *RetryHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
+	handler := AdaptContext(h.handler)
+	for attempt := 1; ; attempt++ {
+		err := handler.HandleEventContext(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if attempt > h.policy.Retries || !IsRetryable(err) || ctx.Err() != nil {
+			if attempt > 1 {
+				return fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		delay := h.policy.Delay(attempt)
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+			if h.policy.MaxDelay > 0 && delay > h.policy.MaxDelay {
+				delay = h.policy.MaxDelay
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("after %d attempts, no time left to retry in %v: %w", attempt, delay, err)
+		}
+		if err := h.sleep(ctx, delay); err != nil {
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+	}
+}
+
+// Handle runs the wrapped handler with retries
+func (h *RetryHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent runs the wrapped handler with retries
+func (h *RetryHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// Description returns the description of the wrapped handler
+func (h *RetryHandler) Description() string {
+	return h.handler.Description()
+}
+
+// Unwrap returns the wrapped handler
+func (h *RetryHandler) Unwrap() EventHandler {
+	return h.handler
+}
+
+// Policy returns the retry policy of the handler
+func (h *RetryHandler) Policy() RetryPolicy {
+	return h.policy
+}
+
+// HasRetry reports whether handler or a handler it wraps retries on its own
+func HasRetry(handler EventHandler) bool {
+	return findDecorator(handler, func(h EventHandler) bool {
+		_, ok := h.(*RetryHandler)
+		return ok
+	})
+}
+
+// sleepContext waits for d, returning early with ctx.Err() if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusSequence serves the given statuses in order, then 200
+func statusSequence(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= len(statuses) {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(statuses[calls-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// recordSleeps makes h record its delays instead of sleeping
+func recordSleeps(h *RetryHandler) *[]time.Duration {
+	var delays []time.Duration
+	h.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return &delays
+}
+
+func TestRetryHandlerRetriesServerErrors(t *testing.T) {
+	server, calls := statusSequence(t, nil, http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	policy := RetryPolicy{Retries: 3, InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2}
+	handler := WithRetry(NewSlackHandler(server.URL, "x"), policy)
+	delays := recordSleeps(handler)
+
+	if err := handler.Handle(1, ""); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+	if fmt.Sprint(*delays) != "[1s 2s]" {
+		t.Errorf("delays = %v, want [1s 2s]", *delays)
+	}
+}
+
+func TestRetryHandlerStopsOnClientErrors(t *testing.T) {
+	server, calls := statusSequence(t, nil, http.StatusNotFound)
+
+	handler := WithRetry(NewWebhookHandler(server.URL), DefaultRetryPolicy(3))
+	recordSleeps(handler)
+
+	err := handler.Handle(1, "")
+	if err == nil || err.Error() != "webhook returned status code 404" {
+		t.Errorf("Handle() error = %v, want the 404 without retries", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestRetryHandlerHonorsRetryAfter(t *testing.T) {
+	server, calls := statusSequence(t, http.Header{"Retry-After": {"7"}}, http.StatusTooManyRequests)
+
+	handler := WithRetry(NewHTTPHandler(server.URL), DefaultRetryPolicy(1))
+	delays := recordSleeps(handler)
+
+	if err := handler.Handle(1, ""); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if *calls != 2 || fmt.Sprint(*delays) != "[7s]" {
+		t.Errorf("calls, delays = %d, %v, want 2, [7s]", *calls, *delays)
+	}
+}
+
+func TestRetryHandlerCapsRetryAfter(t *testing.T) {
+	server, calls := statusSequence(t, http.Header{"Retry-After": {"86400"}}, http.StatusServiceUnavailable)
+
+	handler := WithRetry(NewHTTPHandler(server.URL), DefaultRetryPolicy(1))
+	delays := recordSleeps(handler)
+
+	if err := handler.Handle(1, ""); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if *calls != 2 || fmt.Sprint(*delays) != "[30s]" {
+		t.Errorf("calls, delays = %d, %v, want 2, [30s]", *calls, *delays)
+	}
+}
+
+func TestRetryHandlerGivesUp(t *testing.T) {
+	server, calls := statusSequence(t, nil, 500, 500, 500, 500)
+
+	handler := WithRetry(NewNtfyHandler(server.URL+"/topic", "x"), DefaultRetryPolicy(2))
+	recordSleeps(handler)
+
+	err := handler.Handle(1, "")
+	if err == nil || err.Error() != "after 3 attempts: ntfy returned status code 500" {
+		t.Errorf("Handle() error = %v", err)
+	}
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+		t.Errorf("error does not wrap the HTTPStatusError: %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+}
+
+func TestRetryHandlerRespectsDeadline(t *testing.T) {
+	server, calls := statusSequence(t, http.Header{"Retry-After": {"20"}}, http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	handler := WithRetry(NewHTTPHandler(server.URL), DefaultRetryPolicy(5))
+	err := handler.HandleEventContext(ctx, NewFailureEvent(1, ""))
+	if err == nil || !strings.Contains(err.Error(), "no time left to retry") {
+		t.Errorf("HandleEventContext() error = %v, want no time left", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&HTTPStatusError{StatusCode: 500}, true},
+		{&HTTPStatusError{StatusCode: 429}, true},
+		{&HTTPStatusError{StatusCode: 408}, true},
+		{&HTTPStatusError{StatusCode: 400}, false},
+		{&HTTPStatusError{StatusCode: 403}, false},
+		{fmt.Errorf("wrapped: %w", &HTTPStatusError{StatusCode: 401}), false},
+		{&textproto.Error{Code: 451, Msg: "try again later"}, true},
+		{&textproto.Error{Code: 550, Msg: "no such user"}, false},
+		{Permanent(errors.New("bad template")), false},
+		{context.DeadlineExceeded, true},
+		{errors.New("exit status 1"), true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	var got []time.Duration
+	for n := 1; n <= 5; n++ {
+		got = append(got, policy.Delay(n))
+	}
+	if fmt.Sprint(got) != "[1s 2s 4s 5s 5s]" {
+		t.Errorf("delays = %v, want [1s 2s 4s 5s 5s]", got)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.Delay(1); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("jittered delay %v outside [0.5s, 1.5s]", d)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2025 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 Jan 2025 11:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestHasRetryAndTimeout(t *testing.T) {
+	base := NewSyslogHandler("x")
+	wrapped := WithRetry(WithTimeout(base, time.Second), DefaultRetryPolicy(1))
+	if !HasRetry(wrapped) || !HasTimeout(wrapped) {
+		t.Error("HasRetry, HasTimeout = false for a wrapped handler")
+	}
+	if HasRetry(base) || HasTimeout(base) {
+		t.Error("HasRetry, HasTimeout = true for a plain handler")
+	}
+}
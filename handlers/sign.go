@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature formats accepted by WithSignatureFormat
+const (
+	// SignatureFormatStripe sends "t=TIMESTAMP,v1=HEX" where HEX is the
+	// HMAC-SHA256 of "TIMESTAMP.METHOD\nREQUEST_URI\nBODY", binding the
+	// timestamp, method, path and query to the signature
+	SignatureFormatStripe = "stripe"
+	// SignatureFormatGitHub sends "sha256=HEX" where HEX is the HMAC-SHA256
+	// of the body, as GitHub webhooks do. The timestamp is sent in its own
+	// header but is not signed, so this format neither protects against
+	// replays nor covers the method and URL of the request.
+	SignatureFormatGitHub = "github"
+)
+
+// Default header names and replay tolerance of a Signer
+const (
+	DefaultSignatureHeader       = "X-Signature"
+	DefaultGitHubSignatureHeader = "X-Hub-Signature-256"
+	DefaultTimestampHeader       = "X-Signature-Timestamp"
+	DefaultSignatureTolerance    = 5 * time.Minute
+)
+
+// Signer signs outgoing requests with HMAC-SHA256 and verifies incoming
+// ones. The same Signer configuration is used on both ends.
+type Signer struct {
+	secret          []byte
+	format          string
+	header          string
+	timestampHeader string
+	tolerance       time.Duration
+	now             func() time.Time
+}
+
+// NewSigner creates a Signer using the stripe format by default
+func NewSigner(secret string, options ...func(*Signer)) *Signer {
+	signer := &Signer{
+		secret:          []byte(secret),
+		format:          SignatureFormatStripe,
+		timestampHeader: DefaultTimestampHeader,
+		tolerance:       DefaultSignatureTolerance,
+		now:             time.Now,
+	}
+
+	for _, option := range options {
+		option(signer)
+	}
+
+	if signer.header == "" {
+		signer.header = DefaultSignatureHeader
+		if signer.format == SignatureFormatGitHub {
+			signer.header = DefaultGitHubSignatureHeader
+		}
+	}
+	return signer
+}
+
+// WithSignatureFormat sets the signature format: stripe or github
+func WithSignatureFormat(format string) func(*Signer) {
+	return func(s *Signer) {
+		s.format = format
+	}
+}
+
+// WithSignatureHeader sets the header carrying the signature
+func WithSignatureHeader(header string) func(*Signer) {
+	return func(s *Signer) {
+		s.header = header
+	}
+}
+
+// WithSignatureTolerance sets how far a signed timestamp may be from the
+// current time before VerifyRequest rejects the request as a replay
+func WithSignatureTolerance(tolerance time.Duration) func(*Signer) {
+	return func(s *Signer) {
+		s.tolerance = tolerance
+	}
+}
+
+// ValidSignatureFormat reports whether format is a known signature format
+func ValidSignatureFormat(format string) bool {
+	return format == SignatureFormatStripe || format == SignatureFormatGitHub
+}
+
+// SignRequest adds the signature and timestamp headers to req, whose body is
+// body. The stripe format signs "TIMESTAMP.METHOD\nREQUEST_URI\nBODY", so
+// that the query string of a webhook cannot be replaced; the github format
+// signs the body only.
+func (s *Signer) SignRequest(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	req.Header.Set(s.timestampHeader, timestamp)
+
+	switch s.format {
+	case SignatureFormatGitHub:
+		req.Header.Set(s.header, "sha256="+s.mac(body))
+	default:
+		payload := requestPayload(req.Method, req.URL, body)
+		req.Header.Set(s.header, fmt.Sprintf("t=%s,v1=%s", timestamp, s.mac([]byte(timestamp+"."), payload)))
+	}
+}
+
+// VerifyRequest checks the signature of a received request whose body is
+// body. For the stripe format it also rejects timestamps outside the
+// tolerance; the github format has no replay protection.
+func (s *Signer) VerifyRequest(req *http.Request, body []byte) error {
+	value := req.Header.Get(s.header)
+	if value == "" {
+		return fmt.Errorf("missing %s header", s.header)
+	}
+
+	if s.format == SignatureFormatGitHub {
+		signature, ok := strings.CutPrefix(value, "sha256=")
+		if !ok || !s.equal(signature, s.mac(body)) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = val
+		case "v1":
+			signatures = append(signatures, val)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	if age := s.now().Sub(time.Unix(unix, 0)); age > s.tolerance || age < -s.tolerance {
+		return fmt.Errorf("signature timestamp is %v away from now, outside the tolerance of %v", age.Round(time.Second), s.tolerance)
+	}
+
+	expected := s.mac([]byte(timestamp+"."), requestPayload(req.Method, req.URL, body))
+	for _, signature := range signatures {
+		if s.equal(signature, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// requestPayload returns what the stripe format signs after the timestamp.
+// Neither the method nor the escaped request URI can contain a newline.
+func requestPayload(method string, u *url.URL, body []byte) []byte {
+	payload := []byte(method + "\n" + u.RequestURI() + "\n")
+	return append(payload, body...)
+}
+
+// mac returns the hex-encoded HMAC-SHA256 of the concatenated parts
+func (s *Signer) mac(parts ...[]byte) string {
+	h := hmac.New(sha256.New, s.secret)
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// equal compares hex signatures in constant time
+func (s *Signer) equal(a, b string) bool {
+	return hmac.Equal([]byte(strings.ToLower(a)), []byte(b))
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedSigner returns a signer whose clock is stopped at now
+func fixedSigner(secret string, now time.Time, options ...func(*Signer)) *Signer {
+	signer := NewSigner(secret, options...)
+	signer.now = func() time.Time { return now }
+	return signer
+}
+
+// postRequest returns a POST request to the URL with body
+func postRequest(target string, body []byte) *http.Request {
+	return httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+}
+
+func TestSignerGitHubFormat(t *testing.T) {
+	// Example from the GitHub webhook documentation
+	signer := NewSigner("It's a Secret to Everybody", WithSignatureFormat(SignatureFormatGitHub))
+	req := postRequest("https://example.com/hook", []byte("Hello, World!"))
+	signer.SignRequest(req, []byte("Hello, World!"))
+
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got := req.Header.Get(DefaultGitHubSignatureHeader); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if req.Header.Get(DefaultTimestampHeader) == "" {
+		t.Error("timestamp header not set")
+	}
+	if err := signer.VerifyRequest(req, []byte("Hello, World!")); err != nil {
+		t.Errorf("VerifyRequest failed: %v", err)
+	}
+	if err := signer.VerifyRequest(req, []byte("Hello, World?")); err == nil {
+		t.Error("VerifyRequest accepted a modified body")
+	}
+}
+
+func TestSignerStripeFormat(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := fixedSigner("whsec", now, WithSignatureHeader("X-Failhook-Signature"))
+	body := []byte(`{"exit_code":1}`)
+
+	req := postRequest("https://example.com/hook", body)
+	signer.SignRequest(req, body)
+	value := req.Header.Get("X-Failhook-Signature")
+	if !strings.HasPrefix(value, "t=1700000000,v1=") {
+		t.Fatalf("signature = %q, want t=1700000000,v1=...", value)
+	}
+	if err := signer.VerifyRequest(req, body); err != nil {
+		t.Errorf("VerifyRequest failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		body   string
+		want   string
+	}{
+		{"modified body", signer, `{"exit_code":0}`, "signature mismatch"},
+		{"wrong secret", fixedSigner("other", now, WithSignatureHeader("X-Failhook-Signature")), string(body), "signature mismatch"},
+		{"replayed", fixedSigner("whsec", now.Add(10*time.Minute), WithSignatureHeader("X-Failhook-Signature")), string(body), "outside the tolerance"},
+		{"wrong header", fixedSigner("whsec", now), string(body), "missing X-Signature header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.signer.VerifyRequest(req, []byte(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("VerifyRequest() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// A longer tolerance accepts the old timestamp
+	lenient := fixedSigner("whsec", now.Add(10*time.Minute), WithSignatureHeader("X-Failhook-Signature"), WithSignatureTolerance(time.Hour))
+	if err := lenient.VerifyRequest(req, body); err != nil {
+		t.Errorf("VerifyRequest with a one hour tolerance failed: %v", err)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := fixedSigner("whsec", now)
+	signed := httptest.NewRequest(http.MethodGet, "https://example.com/hook?code=1&host=web1", nil)
+	signer.SignRequest(signed, nil)
+	if err := signer.VerifyRequest(signed, nil); err != nil {
+		t.Fatalf("VerifyRequest failed: %v", err)
+	}
+
+	// A captured signature does not verify for another method or URL
+	tests := map[string]*http.Request{
+		"query":  httptest.NewRequest(http.MethodGet, "https://example.com/hook?code=0&host=web1", nil),
+		"path":   httptest.NewRequest(http.MethodGet, "https://example.com/other?code=1&host=web1", nil),
+		"method": httptest.NewRequest(http.MethodDelete, "https://example.com/hook?code=1&host=web1", nil),
+	}
+	for name, replayed := range tests {
+		replayed.Header = signed.Header.Clone()
+		if err := signer.VerifyRequest(replayed, nil); err == nil || !strings.Contains(err.Error(), "signature mismatch") {
+			t.Errorf("VerifyRequest() with another %s: error = %v, want signature mismatch", name, err)
+		}
+	}
+
+	// The github format signs the body only, as GitHub does
+	github := fixedSigner("whsec", now, WithSignatureFormat(SignatureFormatGitHub))
+	github.SignRequest(signed, []byte("body"))
+	other := postRequest("https://example.com/other", []byte("body"))
+	github.SignRequest(other, []byte("body"))
+	if signed.Header.Get(DefaultGitHubSignatureHeader) != other.Header.Get(DefaultGitHubSignatureHeader) {
+		t.Error("github signatures of requests with the same body differ")
+	}
+}
+
+func TestSignedDeliveries(t *testing.T) {
+	signer := NewSigner("s3cret")
+
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = signer.VerifyRequest(r, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := map[string]FailureHandler{
+		"webhook": NewWebhookHandler(server.URL+"?code=__STATUS_CODE__", WithWebhookSigner(signer)),
+		"slack":   NewSlackHandler(server.URL, "failed: __OUTPUT__", WithSlackSigner(signer)),
+		"http":    NewHTTPHandler(server.URL, WithBody(`{"output": "__OUTPUT__"}`), WithSigner(signer)),
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			verifyErr = nil
+			if err := handler.Handle(1, "boom"); err != nil {
+				t.Fatalf("Handle failed: %v", err)
+			}
+			if verifyErr != nil {
+				t.Errorf("receiver rejected the signature: %v", verifyErr)
+			}
+		})
+	}
+}
@@ -2,17 +2,25 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
+func init() {
+	RegisterScheme("slack", newSlackHandlerFromURL)
+}
+
 // SlackHandler sends a message to Slack on failure
 type SlackHandler struct {
 	webhookURL string
 	message    string
 	channel    string
 	username   string
+	signer     *Signer
 	registry   *PlaceholderRegistry
 }
 
@@ -53,10 +61,48 @@ func WithUsername(username string) func(*SlackHandler) {
 	}
 }
 
+// newSlackHandlerFromURL parses slack://TOKEN_A/TOKEN_B/TOKEN_C, the three
+// parts of an incoming webhook URL, with optional message, channel and
+// username query parameters
+func newSlackHandlerFromURL(u *url.URL) (FailureHandler, error) {
+	tokens := pathSegments(u)
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("slack URL must look like slack://TOKEN_A/TOKEN_B/TOKEN_C")
+	}
+
+	webhookURL := "https://hooks.slack.com/services/" + strings.Join(tokens, "/")
+	query := u.Query()
+	var options []func(*SlackHandler)
+	if channel := query.Get("channel"); channel != "" {
+		options = append(options, WithChannel(channel))
+	}
+	if username := query.Get("username"); username != "" {
+		options = append(options, WithUsername(username))
+	}
+	return NewSlackHandler(webhookURL, queryMessage(u), options...), nil
+}
+
+// WithSlackSigner signs every request with signer
+func WithSlackSigner(signer *Signer) func(*SlackHandler) {
+	return func(h *SlackHandler) {
+		h.signer = signer
+	}
+}
+
 // Handle sends a message to Slack with placeholders replaced
 func (h *SlackHandler) Handle(exitCode int, output string) error {
+	return h.HandleEvent(NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent sends a message to Slack with placeholders replaced
+func (h *SlackHandler) HandleEvent(event *FailureEvent) error {
+	return h.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext sends a message to Slack with placeholders replaced, giving up when ctx is done
+func (h *SlackHandler) HandleEventContext(ctx context.Context, event *FailureEvent) error {
 	// Replace placeholders
-	message := h.registry.Replace(h.message, exitCode, output)
+	message := h.registry.ReplaceEvent(h.message, event)
 
 	// Create the Slack message payload
 	slackMsg := SlackMessage{
@@ -71,19 +117,27 @@ func (h *SlackHandler) Handle(exitCode int, output string) error {
 	// Marshal the message to JSON
 	payload, err := json.Marshal(slackMsg)
 	if err != nil {
-		return fmt.Errorf("error marshaling Slack message: %v", err)
+		return Permanent(fmt.Errorf("error marshaling Slack message: %v", err))
 	}
 
 	// Post to Slack webhook
-	resp, err := http.Post(h.webhookURL, "application/json", bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return Permanent(fmt.Errorf("error creating Slack request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.signer != nil {
+		h.signer.SignRequest(req, payload)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("error sending Slack message: %v", err)
+		return fmt.Errorf("error sending Slack message: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("slack API returned status code %d", resp.StatusCode)
+		return NewHTTPStatusError("slack API", resp)
 	}
 
 	return nil
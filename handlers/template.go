@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Templates are rendered in a single left-to-right pass. Each placeholder is
+// evaluated only if it appears in the template, and substituted values are
+// never scanned again, so output containing placeholder text is inserted
+// verbatim. A backslash directly before __ or {{ makes the following
+// placeholder literal text, e.g. \__OUTPUT__ renders as __OUTPUT__.
+
+// plainTokenPattern matches a __NAME__ or __NAME:filters__ token at the start
+// of the input. Names are upper case words joined by single underscores.
+var plainTokenPattern = regexp.MustCompile(`^__([A-Z][A-Z0-9]*(?:_[A-Z0-9]+)*)(?::(.*?))?__`)
+
+// templateToken is a piece of a scanned template
+type templateToken struct {
+	// literal is the text of a literal piece
+	literal string
+	// raw is the original text of a placeholder, rendered unchanged if the
+	// placeholder cannot be evaluated
+	raw  string
+	expr *placeholderExpr
+	err  error
+}
+
+// placeholderExpr is a parsed placeholder with its filter chain
+type placeholderExpr struct {
+	// name is the registered placeholder, e.g. __OUTPUT__
+	name    string
+	filters []filterCall
+}
+
+// filterCall is one filter of an expression with its arguments
+type filterCall struct {
+	name string
+	args []string
+}
+
+// scan splits text into literal pieces and placeholders. Plain __NAME__
+// tokens that are not registered are kept as literal text.
+func (pr *PlaceholderRegistry) scan(text string) []templateToken {
+	var tokens []templateToken
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			tokens = append(tokens, templateToken{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+	placeholder := func(raw string, expr *placeholderExpr, err error) {
+		flush()
+		tokens = append(tokens, templateToken{raw: raw, expr: expr, err: err})
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		switch {
+		case strings.HasPrefix(rest, `\__`) || strings.HasPrefix(rest, `\{{`):
+			// Escaped placeholder: copy the opening delimiter literally so
+			// it cannot start a placeholder
+			literal.WriteString(rest[1:3])
+			i += 3
+
+		case strings.HasPrefix(rest, "{{"):
+			end := strings.Index(rest[2:], "}}")
+			if end < 0 {
+				literal.WriteString(rest)
+				i = len(text)
+				continue
+			}
+			raw := rest[:end+4]
+			expr, err := parseBraceExpr(rest[2 : end+2])
+			placeholder(raw, expr, err)
+			i += len(raw)
+
+		case strings.HasPrefix(rest, "__"):
+			m := plainTokenPattern.FindStringSubmatchIndex(rest)
+			if m == nil {
+				literal.WriteByte('_')
+				i++
+				continue
+			}
+			raw := rest[:m[1]]
+			name := rest[m[2]:m[3]]
+			if m[4] >= 0 {
+				expr, err := parseColonExpr(name, rest[m[4]:m[5]])
+				placeholder(raw, expr, err)
+			} else if _, ok := pr.placeholders[raw]; ok {
+				placeholder(raw, &placeholderExpr{name: raw}, nil)
+			} else {
+				// Not a placeholder; keep scanning after the first
+				// underscore so overlapping tokens are still found
+				literal.WriteByte('_')
+				i++
+				continue
+			}
+			i += len(raw)
+
+		default:
+			next := len(rest)
+			for _, delim := range []string{"__", "{{", `\`} {
+				if j := strings.Index(rest[1:], delim); j >= 0 && j+1 < next {
+					next = j + 1
+				}
+			}
+			literal.WriteString(rest[:next])
+			i += next
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// escaper encodes substituted values for the context of the template they are
+// inserted into
+type escaper interface {
+	// literal is called with every piece of text written verbatim, in order
+	literal(text string)
+	// escape encodes a value inserted after the text seen so far
+	escape(value string) string
+}
+
+// funcEscaper applies the same encoding to every value
+type funcEscaper func(string) string
+
+func (f funcEscaper) literal(string) {}
+
+func (f funcEscaper) escape(value string) string {
+	return f(value)
+}
+
+// render substitutes every placeholder in text in a single pass. Values are
+// passed through esc unless the expression ends its filter chain with an
+// escaping filter such as json or shell. Placeholders that cannot be
+// evaluated are left unchanged.
+func (pr *PlaceholderRegistry) render(text string, event *FailureEvent, esc escaper) string {
+	var sb strings.Builder
+	write := func(s string) {
+		if esc != nil {
+			esc.literal(s)
+		}
+		sb.WriteString(s)
+	}
+
+	for _, token := range pr.scan(text) {
+		if token.expr == nil && token.err == nil {
+			write(token.literal)
+			continue
+		}
+		if token.err != nil {
+			write(token.raw)
+			continue
+		}
+		value, escaped, err := pr.evaluate(token.expr, event)
+		switch {
+		case err != nil:
+			write(token.raw)
+		case escaped || esc == nil:
+			write(value)
+		default:
+			sb.WriteString(esc.escape(value))
+		}
+	}
+	return sb.String()
+}
+
+// Validate reports the first placeholder expression in text that refers to
+// an unknown placeholder or filter or passes a filter invalid arguments
+func (pr *PlaceholderRegistry) Validate(text string) error {
+	for _, token := range pr.scan(text) {
+		if token.expr == nil && token.err == nil {
+			continue
+		}
+		err := token.err
+		if err == nil {
+			_, _, err = pr.evaluate(token.expr, &FailureEvent{})
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", token.raw, err)
+		}
+	}
+	return nil
+}
+
+// evaluate computes the value of expr and reports whether its filter chain
+// ended with an escaping filter
+func (pr *PlaceholderRegistry) evaluate(expr *placeholderExpr, event *FailureEvent) (string, bool, error) {
+	fn, ok := pr.placeholders[expr.name]
+	if !ok {
+		return "", false, fmt.Errorf("unknown placeholder %s", expr.name)
+	}
+	value := fn(event)
+
+	escaped := false
+	for _, call := range expr.filters {
+		f, ok := pr.filters[call.name]
+		if !ok {
+			return "", false, fmt.Errorf("unknown filter %q", call.name)
+		}
+		var err error
+		if value, err = f.fn(value, call.args); err != nil {
+			return "", false, fmt.Errorf("filter %s: %v", call.name, err)
+		}
+		escaped = f.escapes
+	}
+
+	return value, escaped, nil
+}
+
+// parseBraceExpr parses the body of {{name | filter arg ... | filter}}
+func parseBraceExpr(body string) (*placeholderExpr, error) {
+	var stages [][]string
+	current := []string{}
+	words, err := splitExprWords(body)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range words {
+		if word == nil {
+			stages = append(stages, current)
+			current = []string{}
+			continue
+		}
+		current = append(current, *word)
+	}
+	stages = append(stages, current)
+
+	for _, stage := range stages {
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("empty expression")
+		}
+	}
+	if len(stages[0]) != 1 {
+		return nil, fmt.Errorf("placeholder name must be followed by |")
+	}
+
+	expr := &placeholderExpr{name: "__" + strings.ToUpper(stages[0][0]) + "__"}
+	for _, stage := range stages[1:] {
+		expr.filters = append(expr.filters, filterCall{name: stage[0], args: stage[1:]})
+	}
+	return expr, nil
+}
+
+// splitExprWords splits a brace expression into words. Double-quoted words
+// may contain spaces and Go escape sequences. A nil entry stands for |.
+func splitExprWords(s string) ([]*string, error) {
+	var words []*string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '|':
+			words = append(words, nil)
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			word, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:end+1])
+			}
+			words = append(words, &word)
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t|\"", rune(s[end])) {
+				end++
+			}
+			word := s[i:end]
+			words = append(words, &word)
+			i = end
+		}
+	}
+	return words, nil
+}
+
+// parseColonExpr parses __NAME:filter=arg,filter__
+func parseColonExpr(name, spec string) (*placeholderExpr, error) {
+	expr := &placeholderExpr{name: "__" + name + "__"}
+	for _, part := range strings.Split(spec, ",") {
+		filterName, arg, hasArg := strings.Cut(part, "=")
+		if filterName == "" {
+			return nil, fmt.Errorf("empty filter")
+		}
+		call := filterCall{name: filterName}
+		if hasArg {
+			call.args = []string{arg}
+		}
+		expr.filters = append(expr.filters, call)
+	}
+	return expr, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestRenderSinglePass(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+
+	tests := []struct {
+		name     string
+		text     string
+		exitCode int
+		output   string
+		want     string
+	}{
+		{
+			name:     "output is not re-expanded",
+			text:     "code __STATUS_CODE__: __OUTPUT__",
+			exitCode: 1,
+			output:   "expected __STATUS_CODE__ and {{date}}",
+			want:     "code 1: expected __STATUS_CODE__ and {{date}}",
+		},
+		{
+			name:     "filtered output is not re-expanded",
+			text:     "{{output | upper}}",
+			exitCode: 1,
+			output:   "__status_code__",
+			want:     "__STATUS_CODE__",
+		},
+		{
+			name: "unknown tokens are kept",
+			text: "__UNKNOWN__ __STATUS_CODE__ __lower__",
+			want: "__UNKNOWN__ 0 __lower__",
+		},
+		{
+			name:     "extra underscores",
+			text:     "___STATUS_CODE___",
+			exitCode: 5,
+			want:     "_5_",
+		},
+		{
+			name:     "adjacent tokens",
+			text:     "__STATUS_CODE____STATUS_CODE__",
+			exitCode: 7,
+			want:     "77",
+		},
+		{
+			name:     "escaped plain token",
+			text:     `literal \__STATUS_CODE__, value __STATUS_CODE__`,
+			exitCode: 3,
+			want:     "literal __STATUS_CODE__, value 3",
+		},
+		{
+			name: "escaped expression",
+			text: `literal \{{output}}`,
+			want: "literal {{output}}",
+		},
+		{
+			name:   "other backslashes are kept",
+			text:   `C:\path\__OUTPUT__`,
+			output: "x",
+			want:   `C:\path__OUTPUT__`,
+		},
+		{
+			name: "unterminated expression",
+			text: "{{output",
+			want: "{{output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.Replace(tt.text, tt.exitCode, tt.output); got != tt.want {
+				t.Errorf("Replace(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderEvaluatesOnlyUsedPlaceholders(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+
+	calls := 0
+	registry.Register("__COUNTED__", func(_ int, _ string) string {
+		calls++
+		return "x"
+	})
+
+	registry.Replace("__STATUS_CODE__ __OUTPUT__", 0, "")
+	if calls != 0 {
+		t.Errorf("unused placeholder evaluated %d times, want 0", calls)
+	}
+
+	registry.Replace("__COUNTED__ and __COUNTED__", 0, "")
+	if calls != 2 {
+		t.Errorf("placeholder evaluated %d times, want 2", calls)
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	registry := NewPlaceholderRegistry()
+	// A placeholder whose value looks like another placeholder must not be
+	// expanded again, whatever the registration order
+	registry.Register("__A__", func(_ int, _ string) string { return "__B__" })
+	registry.Register("__B__", func(_ int, _ string) string { return "b" })
+
+	for i := 0; i < 50; i++ {
+		if got := registry.Replace("__A__ __B__", 0, ""); got != "__B__ b" {
+			t.Fatalf("Replace() = %q, want %q", got, "__B__ b")
+		}
+	}
+}
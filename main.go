@@ -3,11 +3,16 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"os/user"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -17,28 +22,187 @@ import (
 
 // FailHook manages the monitoring and failure handling
 type FailHook struct {
-	handlers []handlers.FailureHandler
+	handlers []registeredHandler
 	debug    bool
+
+	// Writers receiving the monitored command's output as it is produced.
+	// A nil writer means the stream is only captured.
+	stdout io.Writer
+	stderr io.Writer
+
+	// How captured stdout and stderr are combined into the handler output
+	captureMode       string
+	captureTags       bool
+	captureTimestamps bool
+
+	// handlerTimeout limits each handler without a timeout of its own, and
+	// totalHandlerTimeout limits all handlers together. Zero means no limit.
+	handlerTimeout      time.Duration
+	totalHandlerTimeout time.Duration
+
+	// retryPolicy applies to handlers without retries of their own
+	retryPolicy handlers.RetryPolicy
+
+	// parallelism limits how many handlers run at once; 0 means no limit
+	parallelism int
+
+	// commandRetry sets how often and with which delays a failed monitored
+	// command is run again before its failure is handled
+	commandRetry handlers.RetryPolicy
+
+	// ignoreCodes and onlyCodes select the nonzero exit codes that count as
+	// failures; nil sets are not applied
+	ignoreCodes handlers.ExitCodes
+	onlyCodes   handlers.ExitCodes
+
+	// outputRules detect failures in the output of a run
+	outputRules *OutputRules
 }
 
 // NewFailHook creates a new FailHook instance
 func NewFailHook(debug bool) *FailHook {
 	return &FailHook{
-		handlers: []handlers.FailureHandler{},
-		debug:    debug,
+		handlers:    []registeredHandler{},
+		debug:       debug,
+		parallelism: 1,
+		captureMode: CaptureSeparate,
 	}
 }
 
-// AddHandler adds a failure handler to the FailHook
+// AddHandler adds a failure handler to the FailHook. Handlers that only
+// implement handlers.FailureHandler are adapted to receive the exit code and
+// combined output of the event.
 func (fh *FailHook) AddHandler(handler handlers.FailureHandler) {
-	fh.handlers = append(fh.handlers, handler)
+	fh.AddEventHandler(handlers.AdaptHandler(handler))
+}
+
+// AddEventHandler adds a handler receiving the full failure event
+func (fh *FailHook) AddEventHandler(handler handlers.EventHandler) {
+	fh.AddEventHandlerToGroup("", handler)
+}
+
+// AddHandlerToGroup adds a failure handler to an ordering group. Handlers of
+// the same group run one after another in the order they were added; an
+// empty group name adds the handler on its own.
+func (fh *FailHook) AddHandlerToGroup(group string, handler handlers.FailureHandler) {
+	fh.AddEventHandlerToGroup(group, handlers.AdaptHandler(handler))
+}
+
+// AddEventHandlerToGroup adds a handler receiving the full failure event to an
+// ordering group, like AddHandlerToGroup
+func (fh *FailHook) AddEventHandlerToGroup(group string, handler handlers.EventHandler) {
+	fh.AddHook(handlers.PhaseFailure, group, handler)
+}
+
+// AddHook adds a handler for one of the handlers.Phase* phases of a run to an
+// ordering group; an empty group name adds the handler on its own
+func (fh *FailHook) AddHook(phase, group string, handler handlers.EventHandler) {
+	fh.handlers = append(fh.handlers, registeredHandler{handler: handler, phase: phase, group: group})
 	if fh.debug {
-		fmt.Printf("Added handler: %s\n", handler.Description())
+		description := handler.Description()
+		if phase != handlers.PhaseFailure {
+			description += " (on " + phase + ")"
+		}
+		if group != "" {
+			fmt.Printf("Added handler: %s (group %s)\n", description, group)
+		} else {
+			fmt.Printf("Added handler: %s\n", description)
+		}
 	}
 }
 
+// Passthrough modes select which of the monitored command's streams are
+// forwarded to failhook's own stdout and stderr
+const (
+	PassthroughBoth   = "both"
+	PassthroughStdout = "stdout"
+	PassthroughStderr = "stderr"
+	PassthroughNone   = "none"
+)
+
+// SetPassthrough sets the writers that receive the monitored command's stdout
+// and stderr in real time. Output is still captured for the handlers. Pass nil
+// to keep a stream silent.
+func (fh *FailHook) SetPassthrough(stdout, stderr io.Writer) {
+	fh.stdout = stdout
+	fh.stderr = stderr
+}
+
+// SetPassthroughMode forwards the monitored command's streams to os.Stdout and
+// os.Stderr according to one of the Passthrough* modes
+func (fh *FailHook) SetPassthroughMode(mode string) error {
+	switch mode {
+	case PassthroughBoth:
+		fh.SetPassthrough(os.Stdout, os.Stderr)
+	case PassthroughStdout:
+		fh.SetPassthrough(os.Stdout, nil)
+	case PassthroughStderr:
+		fh.SetPassthrough(nil, os.Stderr)
+	case PassthroughNone:
+		fh.SetPassthrough(nil, nil)
+	default:
+		return fmt.Errorf("unknown passthrough mode %q (want both, stdout, stderr or none)", mode)
+	}
+	return nil
+}
+
+// Capture modes select how the captured stdout and stderr are combined into
+// the output passed to handlers
+const (
+	// CaptureSeparate places all of stdout before all of stderr
+	CaptureSeparate = "separate"
+	// CaptureInterleaved keeps stdout and stderr lines in arrival order
+	CaptureInterleaved = "interleaved"
+)
+
+// SetCaptureMode selects one of the Capture* modes. In interleaved mode tags
+// prefixes each line with its stream name and timestamps with the time it was
+// received; both are ignored in separate mode.
+func (fh *FailHook) SetCaptureMode(mode string, tags, timestamps bool) error {
+	switch mode {
+	case CaptureSeparate, CaptureInterleaved:
+	default:
+		return fmt.Errorf("unknown capture mode %q (want separate or interleaved)", mode)
+	}
+	fh.captureMode = mode
+	fh.captureTags = tags
+	fh.captureTimestamps = timestamps
+	return nil
+}
+
+// RunResult holds everything captured from a single run of the monitored command
+type RunResult struct {
+	// PID is the process ID of the command, or 0 if it never started
+	PID      int
+	ExitCode int
+	// Signal is the number of the signal that killed the command, or 0
+	Signal int
+	// Output is the combined output formatted according to the capture mode
+	Output string
+	Stdout string
+	Stderr string
+	// Lines holds every output line of both streams in arrival order
+	Lines     []handlers.OutputLine
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+	// Attempts describes every run in order if the command was retried
+	Attempts []handlers.Attempt
+	// Match is the output line that broke an output rule, if any
+	Match string
+	// OutputFailure describes the broken output rule if the run failed only
+	// because of its output
+	OutputFailure string
+}
+
 // RunCommand runs a command and captures its output and exit code
 func (fh *FailHook) RunCommand(ctx context.Context, command string, args []string) (int, string, error) {
+	result, err := fh.Run(ctx, command, args)
+	return result.ExitCode, result.Output, err
+}
+
+// Run runs a command and captures its output, exit code and timing
+func (fh *FailHook) Run(ctx context.Context, command string, args []string) (*RunResult, error) {
 	if fh.debug {
 		fmt.Printf("Running command: %s %s\n", command, strings.Join(args, " "))
 	}
@@ -49,8 +213,9 @@ func (fh *FailHook) RunCommand(ctx context.Context, command string, args []strin
 	cmd := exec.CommandContext(ctx, command, args...)
 
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	recorder := newOutputRecorder()
+	cmd.Stdout = teeWriter(&stdout, recorder.Writer(handlers.StreamStdout), fh.stdout)
+	cmd.Stderr = teeWriter(&stderr, recorder.Writer(handlers.StreamStderr), fh.stderr)
 
 	err := cmd.Run()
 
@@ -61,12 +226,18 @@ func (fh *FailHook) RunCommand(ctx context.Context, command string, args []strin
 		fmt.Printf("Command completed in %v\n", duration)
 	}
 
-	var exitCode int
+	var exitCode, signal int
 	if err != nil {
 		// Try to get the exit code
 		if exitError, ok := err.(*exec.ExitError); ok {
 			if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
-				exitCode = status.ExitStatus()
+				if status.Signaled() {
+					// Follow the shell convention of 128+N for signal deaths
+					signal = int(status.Signal())
+					exitCode = 128 + signal
+				} else {
+					exitCode = status.ExitStatus()
+				}
 			} else {
 				exitCode = 1
 			}
@@ -75,30 +246,359 @@ func (fh *FailHook) RunCommand(ctx context.Context, command string, args []strin
 		}
 	}
 
-	output := strings.TrimSpace(stdout.String() + stderr.String())
-	return exitCode, output, err
+	var pid int
+	if cmd.Process != nil {
+		pid = cmd.Process.Pid
+	}
+
+	result := &RunResult{
+		PID:       pid,
+		ExitCode:  exitCode,
+		Signal:    signal,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Lines:     recorder.Lines(),
+		StartTime: startTime,
+		EndTime:   endTime,
+		Duration:  duration,
+	}
+
+	if fh.captureMode == CaptureInterleaved {
+		result.Output = handlers.FormatOutputLines(result.Lines, fh.captureTags, fh.captureTimestamps)
+	} else {
+		result.Output = strings.TrimSpace(result.Stdout + result.Stderr)
+	}
+	return result, err
+}
+
+// SetFailureCodes selects the exit codes treated as failures. Exit codes in
+// ignore and, if only is not nil, codes not in only are treated like 0: the
+// command is not retried and no handler runs.
+func (fh *FailHook) SetFailureCodes(ignore, only handlers.ExitCodes) {
+	fh.ignoreCodes = ignore
+	fh.onlyCodes = only
+}
+
+// IsFailure reports whether exitCode counts as a failure of the monitored
+// command
+func (fh *FailHook) IsFailure(exitCode int) bool {
+	if exitCode == 0 || fh.ignoreCodes.Contains(exitCode) {
+		return false
+	}
+	return fh.onlyCodes == nil || fh.onlyCodes.Contains(exitCode)
+}
+
+// SetOutputRules sets the rules that make a run fail because of its output
+func (fh *FailHook) SetOutputRules(rules *OutputRules) {
+	fh.outputRules = rules
+}
+
+// Failed reports whether a run failed, either with an exit code counting as
+// failure or by breaking an output rule. It records the line that broke an
+// output rule in result.Match, and the rule in result.OutputFailure if the
+// exit code alone was not a failure.
+func (fh *FailHook) Failed(result *RunResult) bool {
+	match, reason := fh.outputRules.Check(result.Lines)
+	result.Match = match
+	if fh.IsFailure(result.ExitCode) {
+		return true
+	}
+	result.OutputFailure = reason
+	return reason != ""
+}
+
+// Backoff modes for retrying the monitored command
+const (
+	// BackoffFixed waits the same delay before every retry
+	BackoffFixed = "fixed"
+	// BackoffExponential doubles the delay after every retry
+	BackoffExponential = "exponential"
+)
+
+// CommandRetryPolicy returns the policy for retrying the monitored command
+// retries times, waiting delay before the first retry. With exponential
+// backoff the delay doubles after every retry up to maxDelay.
+func CommandRetryPolicy(retries int, delay time.Duration, backoff string, maxDelay time.Duration) (handlers.RetryPolicy, error) {
+	policy := handlers.RetryPolicy{Retries: retries, InitialDelay: delay, Multiplier: 1}
+	switch backoff {
+	case BackoffFixed:
+	case BackoffExponential:
+		policy.Multiplier = 2
+		policy.MaxDelay = maxDelay
+	default:
+		return policy, fmt.Errorf("unknown backoff %q (want fixed or exponential)", backoff)
+	}
+	return policy, nil
+}
+
+// SetCommandRetries sets how often a failed monitored command is run again
+// by RunWithRetries, and how long to wait in between
+func (fh *FailHook) SetCommandRetries(policy handlers.RetryPolicy) {
+	fh.commandRetry = policy
 }
 
-// HandleFailure executes all registered handlers with the exit code and output
-func (fh *FailHook) HandleFailure(exitCode int, output string) {
-	for _, handler := range fh.handlers {
-		if fh.debug {
-			fmt.Printf("Executing handler: %s\n", handler.Description())
+// RunWithRetries runs a command like Run, running it again while it fails
+// with an exit code counting as failure until the retries set with
+// SetCommandRetries are used up or ctx is done. The result describes the
+// last attempt, with the start time of the first one and every attempt in
+// Attempts.
+func (fh *FailHook) RunWithRetries(ctx context.Context, command string, args []string) (*RunResult, error) {
+	var attempts []handlers.Attempt
+	var first time.Time
+	for attempt := 1; ; attempt++ {
+		result, err := fh.Run(ctx, command, args)
+		if attempt == 1 {
+			first = result.StartTime
 		}
-		if err := handler.Handle(exitCode, output); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with handler %s: %v\n", handler.Description(), err)
+		attempts = append(attempts, handlers.Attempt{
+			ExitCode:  result.ExitCode,
+			Signal:    result.Signal,
+			StartTime: result.StartTime,
+			Duration:  result.Duration,
+		})
+
+		last := !fh.Failed(result) || attempt > fh.commandRetry.Retries || ctx.Err() != nil
+		if !last {
+			delay := fh.commandRetry.Delay(attempt)
+			cause := fmt.Sprintf("exit code %d", result.ExitCode)
+			if result.OutputFailure != "" {
+				cause = result.OutputFailure
+			}
+			fmt.Fprintf(os.Stderr, "Attempt %d of %d failed with %s, retrying in %v\n",
+				attempt, fh.commandRetry.Retries+1, cause, delay)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				last = true
+			}
+		}
+		if last {
+			if attempt > 1 {
+				result.StartTime = first
+				result.Duration = result.EndTime.Sub(first)
+				result.Attempts = attempts
+			}
+			return result, err
 		}
 	}
 }
 
+// Defaults for retrying the monitored command
+const (
+	DefaultRetryDelay    = 5 * time.Second
+	DefaultRetryMaxDelay = 5 * time.Minute
+)
+
+// Event builds the failure event for this run of command with args. Secrets
+// in args should be masked by the caller. The event is for the failure
+// handlers; callers change its Phase and Outcome for other handlers.
+func (r *RunResult) Event(command string, args []string) *handlers.FailureEvent {
+	event := newEvent(command, args)
+	event.Phase = handlers.PhaseFailure
+	event.Outcome = handlers.OutcomeFailure
+	event.PID = r.PID
+	event.StartTime = r.StartTime
+	event.EndTime = r.EndTime
+	event.Duration = r.Duration
+	event.ExitCode = r.ExitCode
+	event.Signal = r.Signal
+	event.Output = r.Output
+	event.Stdout = r.Stdout
+	event.Stderr = r.Stderr
+	event.Lines = r.Lines
+	event.Attempts = r.Attempts
+	event.Match = r.Match
+	event.OutputFailure = r.OutputFailure
+	return event
+}
+
+// StartEvent builds the event for the start handlers of a run of command
+// with args. Secrets in args should be masked by the caller.
+func StartEvent(command string, args []string) *handlers.FailureEvent {
+	event := newEvent(command, args)
+	event.Phase = handlers.PhaseStart
+	event.StartTime = time.Now()
+	return event
+}
+
+// newEvent builds an event describing command, args and where they run
+func newEvent(command string, args []string) *handlers.FailureEvent {
+	hostname, _ := os.Hostname()
+	cwd, _ := os.Getwd()
+	return &handlers.FailureEvent{
+		Version:     handlers.EventVersion,
+		RunID:       handlers.NewRunID(),
+		Command:     strings.Join(append([]string{command}, args...), " "),
+		CommandName: command,
+		Args:        args,
+		WorkingDir:  cwd,
+		User:        currentUsername(),
+		Hostname:    hostname,
+	}
+}
+
+// currentUsername returns the name of the user running failhook
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// teeWriter returns a writer that captures into buf and recorder and, if
+// passthrough is not nil, also forwards everything to passthrough. Errors
+// writing to passthrough are ignored, so that a closed pipe such as
+// "| head" does not stop the capture or fail the command.
+func teeWriter(buf *bytes.Buffer, recorder io.Writer, passthrough io.Writer) io.Writer {
+	if passthrough == nil {
+		return io.MultiWriter(buf, recorder)
+	}
+	return io.MultiWriter(buf, recorder, ignoreErrorsWriter{passthrough})
+}
+
+// ignoreErrorsWriter forwards writes to w and always reports success
+type ignoreErrorsWriter struct {
+	w io.Writer
+}
+
+// Write writes p to the wrapped writer and ignores the result
+func (i ignoreErrorsWriter) Write(p []byte) (int, error) {
+	i.w.Write(p)
+	return len(p), nil
+}
+
+// DefaultHandlerTimeout is how long each handler may run unless configured
+// otherwise, so that an unresponsive endpoint cannot hang failhook
+const DefaultHandlerTimeout = 30 * time.Second
+
+// SetHandlerTimeouts sets how long each handler may run unless it was wrapped
+// with handlers.WithTimeout, and how long all handlers may run together. A
+// handler that runs too long is abandoned and reported as failed; handlers
+// left when the total timeout expires are not started. Zero means no limit.
+func (fh *FailHook) SetHandlerTimeouts(perHandler, total time.Duration) {
+	fh.handlerTimeout = perHandler
+	fh.totalHandlerTimeout = total
+}
+
+// SetHandlerRetries sets how handlers without retries of their own are
+// retried when they fail with a retryable error
+func (fh *FailHook) SetHandlerRetries(policy handlers.RetryPolicy) {
+	fh.retryPolicy = policy
+}
+
+// DefaultParallelism is how many handlers the command runs at the same time
+// unless configured otherwise
+const DefaultParallelism = 4
+
+// SetParallelism sets how many handlers may run at the same time. Handlers
+// run one at a time with 1, which is the default, and all at once with 0.
+func (fh *FailHook) SetParallelism(n int) {
+	fh.parallelism = n
+}
+
+// HandleFailure executes all registered handlers with the exit code and output.
+// Every handler is run even if an earlier one fails; the returned error joins
+// the errors of all failed handlers, or is nil if they all succeeded.
+func (fh *FailHook) HandleFailure(exitCode int, output string) error {
+	return fh.HandleEvent(handlers.NewFailureEvent(exitCode, output))
+}
+
+// HandleEvent executes all registered handlers with the failure event.
+// Every handler is run even if an earlier one fails; the returned error joins
+// the errors of all failed handlers, or is nil if they all succeeded.
+func (fh *FailHook) HandleEvent(event *handlers.FailureEvent) error {
+	return fh.HandleEventContext(context.Background(), event)
+}
+
+// HandleEventContext is like HandleEvent, but stops starting handlers and
+// abandons the running ones once ctx is done. The handler timeouts are
+// applied on top of ctx.
+func (fh *FailHook) HandleEventContext(ctx context.Context, event *handlers.FailureEvent) error {
+	return fh.RunHandlers(ctx, event).Err()
+}
+
+// Exit policies control how failhook chooses its own exit status
+const (
+	// ExitPolicyChild exits with the monitored command's exit code
+	ExitPolicyChild = "child"
+	// ExitPolicyHandler exits with the monitored command's exit code, unless a
+	// handler failed, in which case it exits with ExitCodeHandlerError
+	ExitPolicyHandler = "handler"
+	// ExitPolicyZero always exits 0 once the handlers have run
+	ExitPolicyZero = "zero"
+)
+
+// ExitCodeHandlerError is the exit code used by ExitPolicyHandler when at
+// least one failure handler returned an error
+const ExitCodeHandlerError = 125
+
+// validExitPolicy reports whether policy is a known exit policy
+func validExitPolicy(policy string) bool {
+	switch policy {
+	case ExitPolicyChild, ExitPolicyHandler, ExitPolicyZero:
+		return true
+	}
+	return false
+}
+
+// FinalExitCode determines failhook's exit status from the monitored
+// command's exit code and the combined handler error according to policy
+func FinalExitCode(policy string, exitCode int, handlerErr error) int {
+	switch policy {
+	case ExitPolicyZero:
+		return 0
+	case ExitPolicyHandler:
+		if handlerErr != nil {
+			return ExitCodeHandlerError
+		}
+	}
+	return exitCode
+}
+
 func main() {
 	var (
-		command      string
-		webhook      string
-		syslogMsg    string
-		slackWebhook string
-		slackMsg     string
+		configPath   string
+		commands     stringList
+		commandStdin bool
+		execArgvs    stringList
+		webhooks     stringList
+		syslogMsgs   stringList
+		slack        slackFlags
+		notifyURLs   stringList
+		onStart      stringList
+		onSuccess    stringList
+		onFailure    stringList
+		onFinish     stringList
+		signSecret   string
+		signHeader   string
+		signFormat   string
+		handlerTO    time.Duration
+		totalTO      time.Duration
+		retries      int
+		retryDelay   time.Duration
+		parallel     int
+		runRetries   int
+		runDelay     time.Duration
+		runBackoff   string
+		runMaxDelay  time.Duration
+		ignoreCodes  string
+		onlyCodes    string
+		failOnRegex  stringList
+		failOnStderr bool
+		successMarks stringList
+		stateDir     string
+		job          string
+		changesOnly  bool
 		timeout      int
+		exitPolicy   string
+		passthrough  string
+		captureMode  string
+		captureTags  bool
+		captureTimes bool
+		maskArgs     bool
+		maskPatterns stringList
 		debug        bool
 		showUsage    bool
 	)
@@ -106,12 +606,49 @@ func main() {
 	// Define custom flag set to deal with the "--" separator
 	fs := flag.NewFlagSet("failhook", flag.ExitOnError)
 	
-	fs.StringVar(&command, "c", "", "Command to execute on failure")
-	fs.StringVar(&webhook, "w", "", "Webhook URL to call on failure")
-	fs.StringVar(&syslogMsg, "s", "", "Message to send to syslog on failure")
-	fs.StringVar(&slackWebhook, "slack-webhook", "", "Slack webhook URL")
-	fs.StringVar(&slackMsg, "slack-msg", "Command failed with exit code __STATUS_CODE__\n```\n__OUTPUT__\n```", "Message to send to Slack")
-	fs.IntVar(&timeout, "timeout", 0, "Timeout in seconds (0 means no timeout)")
+	fs.StringVar(&configPath, "config", "", "Configuration file (.yaml, .yml, .toml or .json)")
+	fs.Var(&commands, "c", "Command to execute on failure (repeatable)")
+	fs.BoolVar(&commandStdin, "c-stdin", false, "Write the failure event as JSON to the stdin of -c and -exec commands")
+	fs.Var(&execArgvs, "exec", "Command to execute on failure without a shell, as a JSON array of arguments (repeatable)")
+	fs.Var(&webhooks, "w", "Webhook URL to call on failure (repeatable)")
+	fs.Var(&syslogMsgs, "s", "Message to send to syslog on failure (repeatable)")
+	fs.Var(slack.Webhook(), "slack-webhook", "Slack webhook URL (repeatable)")
+	fs.Var(slack.Message(), "slack-msg", "Message to send to Slack")
+	fs.Var(slack.Channel(), "slack-channel", "Slack channel to post to")
+	fs.Var(slack.Username(), "slack-username", "Username to post to Slack as")
+	fs.Var(&notifyURLs, "notify", "Notification URL such as slack://, discord://, ntfy:// or mailto: (repeatable)")
+	fs.Var(&onStart, "on-start", "Notification URL to send to before the command starts (repeatable)")
+	fs.Var(&onSuccess, "on-success", "Notification URL to send to when the command succeeds (repeatable)")
+	fs.Var(&onFailure, "on-failure", "Notification URL to send to when the command fails, like -notify (repeatable)")
+	fs.Var(&onFinish, "on-finish", "Notification URL to send to when the command ends, whether it failed or not (repeatable)")
+	fs.StringVar(&signSecret, "sign-secret", "", "Sign -w and -slack-webhook requests with HMAC-SHA256 using this secret")
+	fs.StringVar(&signHeader, "sign-header", "", "Header carrying the request signature")
+	fs.StringVar(&signFormat, "sign-format", "", "Request signature format: stripe or github")
+	fs.DurationVar(&handlerTO, "handler-timeout", DefaultHandlerTimeout, "How long each handler may run (0 means no limit)")
+	fs.DurationVar(&totalTO, "total-handler-timeout", 0, "How long all handlers may run together (0 means no limit)")
+	fs.IntVar(&retries, "handler-retries", 0, "How often to retry a handler that fails with a retryable error")
+	fs.DurationVar(&retryDelay, "handler-retry-delay", time.Second, "Delay before the first handler retry, doubled for every further retry")
+	fs.IntVar(&parallel, "parallel", DefaultParallelism, "How many handlers may run at the same time (0 means no limit)")
+	fs.IntVar(&runRetries, "retries", 0, "How often to run the command again before handling its failure")
+	fs.DurationVar(&runDelay, "retry-delay", DefaultRetryDelay, "Delay before running the command again")
+	fs.StringVar(&runBackoff, "retry-backoff", BackoffFixed, "How the delay grows between attempts: fixed or exponential")
+	fs.DurationVar(&runMaxDelay, "retry-max-delay", DefaultRetryMaxDelay, "Longest delay between attempts with exponential backoff")
+	fs.StringVar(&ignoreCodes, "ignore-codes", "", "Exit codes that are not failures, e.g. 1,3,64-78")
+	fs.StringVar(&onlyCodes, "only-codes", "", "Only these exit codes are failures, e.g. 2,124-137")
+	fs.Var(&failOnRegex, "fail-on-regex", "Treat the run as failed if an output line matches this regular expression (repeatable)")
+	fs.BoolVar(&failOnStderr, "fail-on-stderr", false, "Treat the run as failed if the command writes to stderr")
+	fs.Var(&successMarks, "success-marker", "Treat the run as failed unless an output line matches this regular expression (repeatable)")
+	fs.StringVar(&stateDir, "state-dir", "", "Directory keeping the outcome of every job between runs")
+	fs.StringVar(&job, "job", "", "Name of the job in the state directory (default: derived from the command line)")
+	fs.BoolVar(&changesOnly, "changes-only", false, "Run success and failure handlers only when the job starts failing or recovers (requires -state-dir)")
+	fs.IntVar(&timeout, "timeout", 0, "Timeout in seconds for all attempts together (0 means no timeout)")
+	fs.StringVar(&exitPolicy, "exit-policy", ExitPolicyChild, "Exit status policy: child, handler or zero")
+	fs.StringVar(&passthrough, "passthrough", PassthroughBoth, "Forward the command's output: both, stdout, stderr or none")
+	fs.StringVar(&captureMode, "capture", CaptureSeparate, "How to combine stdout and stderr: separate or interleaved")
+	fs.BoolVar(&captureTags, "capture-tags", false, "Prefix interleaved output lines with their stream name")
+	fs.BoolVar(&captureTimes, "capture-timestamps", false, "Prefix interleaved output lines with the time they were received")
+	fs.BoolVar(&maskArgs, "mask-args", false, "Mask arguments that look like secrets in notifications")
+	fs.Var(&maskPatterns, "mask-pattern", "Mask arguments matching this regular expression (repeatable)")
 	fs.BoolVar(&debug, "d", false, "Enable debug mode")
 	fs.BoolVar(&showUsage, "h", false, "Show help")
 
@@ -143,6 +680,47 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Options not given as flags can come from FAILHOOK_* environment variables
+	if err := ApplyEnv(fs, os.LookupEnv); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load the configuration file; flags and environment variables override
+	// its options
+	var handlerConfigs []HandlerConfig
+	if configPath != "" {
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cfg.Options.Apply(fs); err != nil {
+			fmt.Printf("Error: %s: %v\n", configPath, err)
+			os.Exit(1)
+		}
+		handlerConfigs = cfg.Handlers
+	}
+
+	if !validExitPolicy(exitPolicy) {
+		fmt.Printf("Error: Unknown exit policy %q (want child, handler or zero)\n", exitPolicy)
+		os.Exit(1)
+	}
+
+	// Compile the patterns of arguments to hide from notifications
+	var secretPatterns []*regexp.Regexp
+	if maskArgs {
+		secretPatterns = append(secretPatterns, handlers.DefaultSecretPatterns...)
+	}
+	for _, pattern := range maskPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Printf("Error: Invalid mask pattern %q: %v\n", pattern, err)
+			os.Exit(1)
+		}
+		secretPatterns = append(secretPatterns, re)
+	}
+
 	// Get monitored command and its arguments
 	monitoredCmd := os.Args[sepIndex+1]
 	var monitoredArgs []string
@@ -176,71 +754,315 @@ func main() {
 
 	// Create FailHook instance
 	failhook := NewFailHook(debug)
+	if err := failhook.SetPassthroughMode(passthrough); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := failhook.SetCaptureMode(captureMode, captureTags, captureTimes); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if handlerTO < 0 || totalTO < 0 {
+		fmt.Printf("Error: Handler timeouts must not be negative\n")
+		os.Exit(1)
+	}
+	failhook.SetHandlerTimeouts(handlerTO, totalTO)
+	if retries < 0 || retryDelay < 0 {
+		fmt.Printf("Error: Handler retries and retry delay must not be negative\n")
+		os.Exit(1)
+	}
+	if parallel < 0 {
+		fmt.Printf("Error: -parallel must not be negative\n")
+		os.Exit(1)
+	}
+	failhook.SetParallelism(parallel)
+	retryPolicy := handlers.DefaultRetryPolicy(retries)
+	retryPolicy.InitialDelay = retryDelay
+	failhook.SetHandlerRetries(retryPolicy)
+	if runRetries < 0 || runDelay < 0 || runMaxDelay < 0 {
+		fmt.Printf("Error: -retries, -retry-delay and -retry-max-delay must not be negative\n")
+		os.Exit(1)
+	}
+	commandRetry, err := CommandRetryPolicy(runRetries, runDelay, runBackoff, runMaxDelay)
+	if err != nil {
+		fmt.Printf("Error: -retry-backoff: %v\n", err)
+		os.Exit(1)
+	}
+	failhook.SetCommandRetries(commandRetry)
+	var ignore, only handlers.ExitCodes
+	if ignoreCodes != "" {
+		if ignore, err = handlers.ParseExitCodes(ignoreCodes); err != nil {
+			fmt.Printf("Error: -ignore-codes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if onlyCodes != "" {
+		if only, err = handlers.ParseExitCodes(onlyCodes); err != nil {
+			fmt.Printf("Error: -only-codes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	failhook.SetFailureCodes(ignore, only)
+	outputRules, err := NewOutputRules(failOnRegex, failOnStderr, successMarks)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	failhook.SetOutputRules(outputRules)
+	if job == "" {
+		job = DefaultJobName(monitoredCmd, monitoredArgs)
+	}
+	if changesOnly && stateDir == "" {
+		fmt.Printf("Error: -changes-only requires -state-dir\n")
+		os.Exit(1)
+	}
 
-	// Register handlers based on flags
-	if command != "" {
-		failhook.AddHandler(handlers.NewCommandHandler(command))
+	// Register handlers from the configuration file, then from flags
+	fileHandlers := len(handlerConfigs)
+	for i, command := range commands {
+		handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("-c[%d]", i), Type: HandlerTypeCommand, Command: command, Stdin: commandStdin})
+	}
+	for i, execArgv := range execArgvs {
+		var argv []string
+		if err := json.Unmarshal([]byte(execArgv), &argv); err != nil || len(argv) == 0 {
+			fmt.Printf("Error: -exec must be a non-empty JSON array of strings, e.g. '[\"/usr/bin/notify\", \"__STATUS_CODE__\"]'\n")
+			os.Exit(1)
+		}
+		handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("-exec[%d]", i), Type: HandlerTypeExec, Argv: argv, Stdin: commandStdin})
+	}
+	for i, webhook := range webhooks {
+		handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("-w[%d]", i), Type: HandlerTypeWebhook, URL: webhook})
+	}
+	for i, syslogMsg := range syslogMsgs {
+		handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("-s[%d]", i), Type: HandlerTypeSyslog, Message: syslogMsg})
+	}
+	handlerConfigs = append(handlerConfigs, slack.Configs()...)
+	for i, notifyURL := range notifyURLs {
+		handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("-notify[%d]", i), Type: HandlerTypeNotify, URL: notifyURL})
+	}
+	for _, hook := range []struct {
+		flag  string
+		phase string
+		urls  stringList
+	}{
+		{"-on-start", handlers.PhaseStart, onStart},
+		{"-on-success", handlers.PhaseSuccess, onSuccess},
+		{"-on-failure", handlers.PhaseFailure, onFailure},
+		{"-on-finish", handlers.PhaseFinish, onFinish},
+	} {
+		for i, url := range hook.urls {
+			handlerConfigs = append(handlerConfigs, HandlerConfig{Name: fmt.Sprintf("%s[%d]", hook.flag, i), Type: HandlerTypeNotify, URL: url, On: []string{hook.phase}})
+		}
 	}
-	if webhook != "" {
-		failhook.AddHandler(handlers.NewWebhookHandler(webhook))
+	for i := range handlerConfigs[fileHandlers:] {
+		hc := &handlerConfigs[fileHandlers+i]
+		if hc.Type == HandlerTypeWebhook || hc.Type == HandlerTypeSlack {
+			hc.SigningSecret, hc.SignatureHeader, hc.SignatureFormat = signSecret, signHeader, signFormat
+		}
 	}
-	if syslogMsg != "" {
-		failhook.AddHandler(handlers.NewSyslogHandler(syslogMsg))
+	for _, hc := range handlerConfigs {
+		if hc.Filter != nil && hc.Filter.Changed && stateDir == "" {
+			fmt.Printf("Error: handler %s: filter.changed requires -state-dir\n", hc.Name)
+			os.Exit(1)
+		}
+		hc.ApplyDefaultTimeout(handlerTO)
+		hc.SetJob(job)
+		handler, err := hc.Build()
+		if err != nil {
+			fmt.Printf("Error: handler %s: %v\n", hc.Name, err)
+			os.Exit(1)
+		}
+		for _, phase := range hc.Phases() {
+			failhook.AddHook(phase, hc.Group, handlers.AdaptHandler(handler))
+		}
 	}
-	if slackWebhook != "" {
-		failhook.AddHandler(handlers.NewSlackHandler(slackWebhook, slackMsg))
+
+	// Run the start handlers before the monitored command. Unlike the other
+	// handlers they are canceled by a timeout or interrupt.
+	maskedArgs := handlers.MaskArgs(monitoredArgs, secretPatterns)
+	var startEvent *handlers.FailureEvent
+	var startErr error
+	if failhook.HasHandlers(handlers.PhaseStart) {
+		startEvent = StartEvent(monitoredCmd, maskedArgs)
+		startErr = failhook.HandleEventContext(ctx, startEvent)
 	}
 
 	// Run the monitored command
-	exitCode, output, err := failhook.RunCommand(ctx, monitoredCmd, monitoredArgs)
+	result, err := failhook.RunWithRetries(ctx, monitoredCmd, monitoredArgs)
+	event := result.Event(monitoredCmd, maskedArgs)
+	if startEvent != nil {
+		event.RunID = startEvent.RunID
+	}
 
 	// Check if the context was canceled due to timeout
 	if ctx.Err() == context.DeadlineExceeded {
 		fmt.Fprintf(os.Stderr, "Command timed out after %d seconds\n", timeout)
-		exitCode = 124 // Standard timeout exit code
-		output = fmt.Sprintf("Command timed out after %d seconds", timeout)
+		event.ExitCode = 124 // Standard timeout exit code
+		event.Output = fmt.Sprintf("Command timed out after %d seconds", timeout)
+		event.TimedOut = true
 	} else if ctx.Err() == context.Canceled && err != nil {
 		fmt.Fprintf(os.Stderr, "Command was interrupted\n")
-		exitCode = 130 // Standard exit code for SIGINT
-		output = "Command was interrupted"
+		event.ExitCode = 130 // Standard exit code for SIGINT
+		event.Output = "Command was interrupted"
+		event.Interrupted = true
 	}
+	exitCode := event.ExitCode
 
-	// If command succeeded, exit normally
-	if exitCode == 0 {
+	// A command whose output broke an output rule failed whatever its exit
+	// code; failhook reports it with a nonzero exit status
+	if event.OutputFailure != "" {
+		fmt.Fprintf(os.Stderr, "Command failed: %s\n", event.OutputFailure)
+		if exitCode == 0 {
+			exitCode = ExitCodeOutputFailure
+		}
+	}
+
+	// Exit codes excluded by -ignore-codes and -only-codes are not failures
+	failed := exitCode != 0 && (failhook.IsFailure(exitCode) || event.OutputFailure != "")
+	if failed {
 		if debug {
-			fmt.Println("Command succeeded, exiting normally")
+			fmt.Printf("Command failed with exit code %d, executing handlers\n", exitCode)
+		}
+	} else {
+		event.Phase, event.Outcome = handlers.PhaseSuccess, handlers.OutcomeSuccess
+		if debug && exitCode == 0 {
+			fmt.Println("Command succeeded")
+		} else if debug {
+			fmt.Printf("Exit code %d is not a failure\n", exitCode)
 		}
-		os.Exit(0)
 	}
 
-	// If command failed, handle failure actions
-	if debug {
-		fmt.Printf("Command failed with exit code %d, executing handlers\n", exitCode)
+	// Record the outcome in the state directory. Without state every run
+	// counts as a change, so a broken state directory does not hide failures.
+	if stateDir != "" {
+		previous, current, err := UpdateState(stateDir, job, event.Outcome, event.StartTime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating the state of job %s: %v\n", job, err)
+		} else {
+			ApplyState(event, job, previous, current)
+		}
+	}
+
+	var handlerErr error
+	if changesOnly && !event.Changed() {
+		if debug {
+			fmt.Printf("Outcome of job %s unchanged (%s), skipping %s handlers\n", job, event.Outcome, event.Phase)
+		}
+	} else {
+		handlerErr = failhook.HandleEvent(event)
 	}
-	failhook.HandleFailure(exitCode, output)
+
+	// The finish handlers run last, whatever the outcome
+	finishEvent := *event
+	finishEvent.Phase = handlers.PhaseFinish
+	finishErr := failhook.HandleEvent(&finishEvent)
+
+	os.Exit(FinalExitCode(exitPolicy, exitCode, errors.Join(startErr, handlerErr, finishErr)))
 }
 
 func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  failhook [OPTIONS] -- program [args...]")
 	fmt.Println("\nOptions:")
-	fmt.Println("  -c  Command to execute on failure")
+	fmt.Println("  -config         Configuration file (.yaml, .yml, .toml or .json); flags override its options")
+	fmt.Println("  -c  Command to execute on failure (placeholder values are passed in environment variables)")
+	fmt.Println("  -exec           Command to execute on failure without a shell, as a JSON array of arguments")
+	fmt.Println("  -c-stdin        Write the failure event as JSON to the stdin of -c and -exec commands")
 	fmt.Println("  -w  Webhook URL to call on failure")
 	fmt.Println("  -s  Message to send to syslog on failure")
 	fmt.Println("  -slack-webhook  Slack webhook URL")
-	fmt.Println("  -slack-msg      Message to send to Slack (default: \"Command failed with exit code __STATUS_CODE__\\n```\\n__OUTPUT__\\n```\")")
-	fmt.Println("  -timeout        Timeout in seconds (0 means no timeout)")
+	fmt.Println("  -slack-msg      Message to send to Slack (default: \"Command __SUMMARY__\\n```\\n__OUTPUT__\\n```\")")
+	fmt.Println("  -slack-channel  Slack channel to post to")
+	fmt.Println("  -slack-username Username to post to Slack as (default: FailHook)")
+	fmt.Println("  -notify         Notification URL; the scheme picks the service:")
+	fmt.Println("                    slack://TOKEN_A/TOKEN_B/TOKEN_C[?channel=&username=&message=]")
+	fmt.Println("                    discord://TOKEN@WEBHOOK_ID[?username=&message=]")
+	fmt.Println("                    ntfy://[USER:PASSWORD@]HOST/TOPIC[?title=&priority=&tags=&message=]")
+	fmt.Println("                    mailto:ADDR[,ADDR...][?smtp=HOST:PORT&from=&subject=&body=]")
+	fmt.Println("                    http(s)://... (webhook), syslog://[?message=]")
+	fmt.Println("  -on-start       Notification URL to send to before the command starts, like -notify")
+	fmt.Println("  -on-success     Notification URL to send to when the command succeeds")
+	fmt.Println("  -on-failure     Notification URL to send to when the command fails, the same as -notify")
+	fmt.Println("  -on-finish      Notification URL to send to when the command ends, whether it failed or not")
+	fmt.Println("  -on-* take notification URLs only; use \"on\" in the configuration file for other handlers.")
+	fmt.Println("  -c, -exec, -w, -s, -slack-webhook, -notify and -on-* can be repeated to run several handlers of the same kind.")
+	fmt.Println("  -slack-msg, -slack-channel and -slack-username apply to the preceding -slack-webhook,")
+	fmt.Println("  or to every Slack webhook when given before the first one.")
+	fmt.Println("  -sign-secret    Sign -w and -slack-webhook requests with HMAC-SHA256 using this secret (or env:NAME, file:/path)")
+	fmt.Println("  -sign-header    Header carrying the signature (default: X-Signature, or X-Hub-Signature-256 for github)")
+	fmt.Println("  -sign-format    Signature format: stripe (t=TIMESTAMP,v1=HMAC of TIMESTAMP.METHOD, URI and BODY) or github (sha256=HMAC of BODY, not for -w)")
+	fmt.Println("  -handler-timeout  How long each handler may run, e.g. 10s or 2m; 0 means no limit (default: 30s)")
+	fmt.Println("  -total-handler-timeout  How long all handlers may run together; 0 means no limit (default: 0)")
+	fmt.Println("  -handler-retries  Retry handlers failing with network errors, 429 or 5xx this many times (default: 0)")
+	fmt.Println("  -handler-retry-delay  Delay before the first retry, doubled up to 30s with jitter (default: 1s)")
+	fmt.Println("  -parallel       How many handlers run at the same time; 0 means no limit (default: 4)")
+	fmt.Println("  -retries        Run the failed command again up to this many times before running handlers (default: 0)")
+	fmt.Println("  -retry-delay    Delay before running the command again (default: 5s)")
+	fmt.Println("  -retry-backoff  fixed (same delay every time) or exponential (doubling up to -retry-max-delay) (default: fixed)")
+	fmt.Println("  -retry-max-delay  Longest delay between attempts with exponential backoff (default: 5m)")
+	fmt.Println("  -ignore-codes   Exit codes that are not failures, as a list with ranges, e.g. 1,3,64-78")
+	fmt.Println("  -only-codes     Only these exit codes are failures, e.g. 2,124-137")
+	fmt.Println("  -fail-on-regex  Fail the run if an output line matches this regular expression, even on exit code 0 (repeatable)")
+	fmt.Println("  -fail-on-stderr Fail the run if the command writes anything to stderr")
+	fmt.Println("  -success-marker Fail the run unless an output line matches this regular expression (repeatable)")
+	fmt.Println("  -state-dir      Directory keeping the outcome of every job between runs, e.g. /var/lib/failhook")
+	fmt.Println("  -job            Name of the job in the state directory (default: program name and a hash of the command line)")
+	fmt.Println("  -changes-only   Run success and failure handlers only when the job starts failing or recovers")
+	fmt.Println("  -timeout        Timeout in seconds for all attempts together (0 means no timeout)")
+	fmt.Println("  -exit-policy    Exit status policy (default: child)")
+	fmt.Println("                    child    exit with the monitored command's exit code")
+	fmt.Println("                    handler  like child, but exit 125 if any handler fails")
+	fmt.Println("                    zero     always exit 0 after running handlers")
+	fmt.Println("  -passthrough    Forward the command's output while it runs: both, stdout, stderr or none (default: both)")
+	fmt.Println("  -capture        How to combine stdout and stderr in __OUTPUT__: separate or interleaved (default: separate)")
+	fmt.Println("  -capture-tags   Prefix interleaved output lines with [stdout] or [stderr]")
+	fmt.Println("  -capture-timestamps  Prefix interleaved output lines with the time they were received")
+	fmt.Println("  -mask-args      Mask arguments that look like secrets (password, token, ...) in notifications")
+	fmt.Println("  -mask-pattern   Mask arguments matching this regular expression (repeatable)")
 	fmt.Println("  -d              Enable debug mode")
 	fmt.Println("  -h              Show this help message")
+	fmt.Println("\nEnvironment:")
+	fmt.Println("  Every option can be set with FAILHOOK_<NAME>, e.g. FAILHOOK_SLACK_WEBHOOK for -slack-webhook.")
+	fmt.Println("  Repeatable options also read FAILHOOK_<NAME>_1, FAILHOOK_<NAME>_2, ...")
+	fmt.Println("  Flags override environment variables, which override the configuration file.")
+	fmt.Println("  Handler settings may be references resolved at startup: env:NAME or file:/path")
 	fmt.Println("\nPlaceholders:")
 	fmt.Println("  __STATUS_CODE__  Exit code of the failed command")
 	fmt.Println("  __OUTPUT__       Combined stdout and stderr output of the failed command")
+	fmt.Println("  __STDOUT__       Standard output of the failed command")
+	fmt.Println("  __STDERR__       Standard error of the failed command")
+	fmt.Println("  __OUTPUT_TAIL__, __STDOUT_TAIL__, __STDERR_TAIL__  Last 20 lines of the output or stream")
+	fmt.Println("  __OUTPUT_SIZE__, __STDOUT_SIZE__, __STDERR_SIZE__  Size of the output or stream in bytes")
+	fmt.Println("  __COMMAND__      Full command line of the failed command")
+	fmt.Println("  __ARGS__         Arguments of the failed command")
+	fmt.Println("  __CWD__          Working directory of the failed command")
+	fmt.Println("  __USER__         User running the failed command")
+	fmt.Println("  __HOSTNAME__     Host name")
+	fmt.Println("  __FQDN__         Fully qualified domain name of the host")
+	fmt.Println("  __PID__          Process ID of the failed command")
+	fmt.Println("  __DURATION__          How long the command ran (e.g. 1m30.25s)")
+	fmt.Println("  __DURATION_SECONDS__  How long the command ran in seconds (e.g. 90.250)")
+	fmt.Println("  __START_TIME__   When the command started, in RFC3339 format")
+	fmt.Println("  __END_TIME__     When the command finished, in RFC3339 format")
+	fmt.Println("  __ATTEMPTS__     How often the command ran (see -retries)")
+	fmt.Println("  __ATTEMPT_EXIT_CODES__  Exit code of every attempt, e.g. 1,1,75")
+	fmt.Println("  __MATCH__        Output line that matched -fail-on-regex or was written to stderr with -fail-on-stderr")
+	fmt.Println("  __PHASE__        Phase the handler runs in: start, success, failure or finish")
+	fmt.Println("  __OUTCOME__      success or failure once the command ended, empty before it starts")
+	fmt.Println("  __SUMMARY__      What happened, e.g. started, succeeded or failed with exit code 2")
+	fmt.Println("  __CONSECUTIVE_FAILURES__  Failed runs of the job in a row (see -state-dir)")
+	fmt.Println("  __FAILING_SINCE__  When the job started failing, in RFC3339 format")
 	fmt.Println("  __TIMESTAMP__    Current timestamp in RFC3339 format")
 	fmt.Println("  __DATE__         Current date (YYYY-MM-DD)")
 	fmt.Println("  __TIME__         Current time (HH:MM:SS)")
+	fmt.Println("\nFilters:")
+	fmt.Println("  {{output | tail 40 | json}} or __OUTPUT:tail=40,json__")
+	fmt.Println("  tail N, head N, max N, trim, upper, lower, default V, tz ZONE, format LAYOUT,")
+	fmt.Println("  json, shell, url, urlpath, html, base64, raw")
 	fmt.Println("\nExamples:")
 	fmt.Println("  failhook -c \"echo 'Command failed with code: __STATUS_CODE__'\" -- /path/to/program")
 	fmt.Println("  failhook -w \"https://example.com/hook?status=__STATUS_CODE__&output=__OUTPUT__\" -- /path/to/program")
 	fmt.Println("  failhook -slack-webhook \"https://hooks.slack.com/services/XXX/YYY/ZZZ\" -- /path/to/program")
+	fmt.Println("  failhook -notify \"ntfy://ntfy.sh/backups?priority=high\" -notify \"mailto:ops@example.com\" -- /path/to/program")
 	fmt.Println("  failhook -timeout 30 -s \"Program timed out after 30s\" -- /path/to/long-running-program")
 }
\ No newline at end of file
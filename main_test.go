@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/zishida/failhook/handlers"
 )
 
 func TestFailHook_RunCommand(t *testing.T) {
@@ -43,6 +47,19 @@ func TestFailHook_RunCommand(t *testing.T) {
 		}
 	})
 	
+	// Test command killed by a signal
+	t.Run("command killed by signal", func(t *testing.T) {
+		ctx := context.Background()
+		exitCode, _, err := failhook.RunCommand(ctx, "sh", []string{"-c", "kill -TERM $$"})
+
+		if exitCode != 128+15 {
+			t.Errorf("exitCode = %d, want %d", exitCode, 128+15)
+		}
+		if err == nil {
+			t.Error("error = nil, want error")
+		}
+	})
+
 	// Test timeout
 	t.Run("command timeout", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
@@ -73,6 +90,115 @@ func TestFailHook_RunCommand(t *testing.T) {
 	})
 }
 
+// failingWriter fails every write, like a pipe whose reader exited
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestFailHook_Passthrough(t *testing.T) {
+	cmd := `echo "to stdout"; echo "to stderr" >&2`
+
+	t.Run("both streams", func(t *testing.T) {
+		failhook := NewFailHook(false)
+		var stdout, stderr strings.Builder
+		failhook.SetPassthrough(&stdout, &stderr)
+
+		_, output, err := failhook.RunCommand(context.Background(), "sh", []string{"-c", cmd})
+		if err != nil {
+			t.Fatalf("RunCommand failed: %v", err)
+		}
+
+		if stdout.String() != "to stdout\n" {
+			t.Errorf("passthrough stdout = %q, want %q", stdout.String(), "to stdout\n")
+		}
+		if stderr.String() != "to stderr\n" {
+			t.Errorf("passthrough stderr = %q, want %q", stderr.String(), "to stderr\n")
+		}
+		// Output is still captured for handlers
+		if !strings.Contains(output, "to stdout") || !strings.Contains(output, "to stderr") {
+			t.Errorf("output = %q, want both stdout and stderr", output)
+		}
+	})
+
+	t.Run("stderr only", func(t *testing.T) {
+		failhook := NewFailHook(false)
+		var stderr strings.Builder
+		failhook.SetPassthrough(nil, &stderr)
+
+		_, output, _ := failhook.RunCommand(context.Background(), "sh", []string{"-c", cmd})
+
+		if stderr.String() != "to stderr\n" {
+			t.Errorf("passthrough stderr = %q, want %q", stderr.String(), "to stderr\n")
+		}
+		if !strings.Contains(output, "to stdout") {
+			t.Errorf("output = %q, want captured stdout", output)
+		}
+	})
+
+	t.Run("closed reader", func(t *testing.T) {
+		failhook := NewFailHook(false)
+		failhook.SetPassthrough(failingWriter{}, failingWriter{})
+
+		exitCode, output, err := failhook.RunCommand(context.Background(), "sh", []string{"-c", cmd})
+		if err != nil || exitCode != 0 {
+			t.Errorf("exitCode, err = %d, %v, want 0, nil when passthrough fails", exitCode, err)
+		}
+		if !strings.Contains(output, "to stdout") || !strings.Contains(output, "to stderr") {
+			t.Errorf("output = %q, want both streams captured", output)
+		}
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		failhook := NewFailHook(false)
+		if err := failhook.SetPassthroughMode("sideways"); err == nil {
+			t.Error("SetPassthroughMode() error = nil, want error")
+		}
+	})
+}
+
+func TestFailHook_CaptureMode(t *testing.T) {
+	cmd := `echo one; sleep 0.05; echo two >&2; sleep 0.05; echo three`
+
+	tests := []struct {
+		name       string
+		mode       string
+		tags       bool
+		wantOutput string
+	}{
+		{"separate", CaptureSeparate, false, "one\nthree\ntwo"},
+		{"interleaved", CaptureInterleaved, false, "one\ntwo\nthree"},
+		{"interleaved with tags", CaptureInterleaved, true, "[stdout] one\n[stderr] two\n[stdout] three"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failhook := NewFailHook(false)
+			if err := failhook.SetCaptureMode(tt.mode, tt.tags, false); err != nil {
+				t.Fatalf("SetCaptureMode failed: %v", err)
+			}
+
+			result, err := failhook.Run(context.Background(), "sh", []string{"-c", cmd})
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			if result.Output != tt.wantOutput {
+				t.Errorf("output = %q, want %q", result.Output, tt.wantOutput)
+			}
+			if len(result.Lines) != 3 || result.Lines[1].Stream != "stderr" {
+				t.Errorf("lines = %+v, want stderr line second", result.Lines)
+			}
+		})
+	}
+
+	failhook := NewFailHook(false)
+	if err := failhook.SetCaptureMode("shuffled", false, false); err == nil {
+		t.Error("SetCaptureMode() error = nil, want error")
+	}
+}
+
 // testHandler is a helper type for testing
 type testHandler struct {
 	outputPath string
@@ -147,6 +273,345 @@ func TestHandleFailure(t *testing.T) {
 	}
 }
 
+// testEventHandler records the event it was called with
+type testEventHandler struct {
+	received *handlers.FailureEvent
+}
+
+// HandleEvent implements the handlers.EventHandler interface
+func (h *testEventHandler) HandleEvent(event *handlers.FailureEvent) error {
+	h.received = event
+	return nil
+}
+
+// Description implements the handlers.EventHandler interface
+func (h *testEventHandler) Description() string {
+	return "Test event handler"
+}
+
+func TestHandleEvent(t *testing.T) {
+	failhook := NewFailHook(false)
+
+	plain := &testHandler{outputPath: filepath.Join(t.TempDir(), "output.txt")}
+	withEvent := &testEventHandler{}
+	failhook.AddHandler(plain)
+	failhook.AddEventHandler(withEvent)
+
+	event := &handlers.FailureEvent{ExitCode: 3, Output: "out\nerr", Stdout: "out\n", Stderr: "err\n"}
+	if err := failhook.HandleEvent(event); err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+
+	// Plain handlers receive the combined output
+	content, err := os.ReadFile(plain.outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if string(content) != event.Output {
+		t.Errorf("handler output = %q, want %q", string(content), event.Output)
+	}
+
+	// Event handlers receive the whole event
+	if withEvent.received != event {
+		t.Errorf("event handler received %+v, want %+v", withEvent.received, event)
+	}
+}
+
+// stuckHandler blocks until release is closed, ignoring cancellation
+type stuckHandler struct {
+	release chan struct{}
+}
+
+// HandleEvent implements the handlers.EventHandler interface
+func (h *stuckHandler) HandleEvent(event *handlers.FailureEvent) error {
+	<-h.release
+	return nil
+}
+
+// Description implements the handlers.EventHandler interface
+func (h *stuckHandler) Description() string {
+	return "Stuck handler"
+}
+
+func TestHandleEventHandlerTimeout(t *testing.T) {
+	stuck := &stuckHandler{release: make(chan struct{})}
+	defer close(stuck.release)
+
+	failhook := NewFailHook(false)
+	failhook.SetHandlerTimeouts(50*time.Millisecond, 0)
+	withEvent := &testEventHandler{}
+	failhook.AddEventHandler(stuck)
+	failhook.AddEventHandler(withEvent)
+
+	err := failhook.HandleEvent(handlers.NewFailureEvent(1, ""))
+	if err == nil || !strings.Contains(err.Error(), "Stuck handler: timed out after 50ms") {
+		t.Errorf("HandleEvent() error = %v, want the stuck handler reported", err)
+	}
+	if withEvent.received == nil {
+		t.Error("the handler after the stuck one did not run")
+	}
+}
+
+func TestHandleEventOwnTimeoutOverridesDefault(t *testing.T) {
+	failhook := NewFailHook(false)
+	failhook.SetHandlerTimeouts(10*time.Millisecond, 0)
+	failhook.AddHandler(handlers.WithTimeout(handlers.NewCommandHandler("sleep 0.2"), 5*time.Second))
+
+	if err := failhook.HandleEvent(handlers.NewFailureEvent(1, "")); err != nil {
+		t.Errorf("HandleEvent() error = %v, want the handler's own timeout to apply", err)
+	}
+}
+
+func TestHandleEventTotalTimeout(t *testing.T) {
+	stuck := &stuckHandler{release: make(chan struct{})}
+	defer close(stuck.release)
+
+	failhook := NewFailHook(false)
+	failhook.SetHandlerTimeouts(0, 50*time.Millisecond)
+	skipped := &testEventHandler{}
+	failhook.AddEventHandler(stuck)
+	failhook.AddEventHandler(skipped)
+
+	start := time.Now()
+	err := failhook.HandleEvent(handlers.NewFailureEvent(1, ""))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("HandleEvent returned after %v, want the total timeout to stop it", elapsed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "Test event handler: not run") {
+		t.Errorf("HandleEvent() error = %v, want the skipped handler reported", err)
+	}
+	if skipped.received != nil {
+		t.Error("a handler was started after the total timeout expired")
+	}
+}
+
+// flakyHandler fails until it has been called succeedAfter times
+type flakyHandler struct {
+	calls        int
+	succeedAfter int
+}
+
+// HandleEvent implements the handlers.EventHandler interface
+func (h *flakyHandler) HandleEvent(event *handlers.FailureEvent) error {
+	h.calls++
+	if h.calls < h.succeedAfter {
+		return errors.New("temporary failure")
+	}
+	return nil
+}
+
+// Description implements the handlers.EventHandler interface
+func (h *flakyHandler) Description() string {
+	return "Flaky handler"
+}
+
+func TestHandleEventRetries(t *testing.T) {
+	failhook := NewFailHook(false)
+	failhook.SetHandlerRetries(handlers.RetryPolicy{Retries: 2, InitialDelay: time.Millisecond})
+	flaky := &flakyHandler{succeedAfter: 3}
+	failhook.AddEventHandler(flaky)
+
+	if err := failhook.HandleEvent(handlers.NewFailureEvent(1, "")); err != nil {
+		t.Errorf("HandleEvent() error = %v, want success on the third attempt", err)
+	}
+	if flaky.calls != 3 {
+		t.Errorf("calls = %d, want 3", flaky.calls)
+	}
+
+	// Handlers with their own retry policy keep it
+	failhook = NewFailHook(false)
+	failhook.SetHandlerRetries(handlers.RetryPolicy{Retries: 5, InitialDelay: time.Millisecond})
+	flaky = &flakyHandler{succeedAfter: 3}
+	failhook.AddEventHandler(handlers.WithRetry(flaky, handlers.RetryPolicy{Retries: 0}))
+
+	if err := failhook.HandleEvent(handlers.NewFailureEvent(1, "")); err == nil {
+		t.Error("HandleEvent() error = nil, want the handler's own policy without retries")
+	}
+	if flaky.calls != 1 {
+		t.Errorf("calls = %d, want 1", flaky.calls)
+	}
+}
+
+func TestRunResult_Event(t *testing.T) {
+	failhook := NewFailHook(false)
+	result, _ := failhook.Run(context.Background(), "sh", []string{"-c", "echo out; echo err >&2; exit 4"})
+
+	event := result.Event("sh", []string{"-c", "echo out; echo err >&2; exit 4"})
+
+	if event.Version != handlers.EventVersion {
+		t.Errorf("Version = %d, want %d", event.Version, handlers.EventVersion)
+	}
+	if event.RunID == "" {
+		t.Error("RunID is empty")
+	}
+	if event.ExitCode != 4 {
+		t.Errorf("ExitCode = %d, want 4", event.ExitCode)
+	}
+	if event.Command != "sh -c echo out; echo err >&2; exit 4" {
+		t.Errorf("Command = %q", event.Command)
+	}
+	if event.Stdout != "out\n" || event.Stderr != "err\n" {
+		t.Errorf("Stdout, Stderr = %q, %q, want %q, %q", event.Stdout, event.Stderr, "out\n", "err\n")
+	}
+	if event.PID == 0 || event.WorkingDir == "" || event.Hostname == "" {
+		t.Errorf("PID, WorkingDir, Hostname = %d, %q, %q, want all set", event.PID, event.WorkingDir, event.Hostname)
+	}
+	if event.StartTime.IsZero() || event.EndTime.Before(event.StartTime) {
+		t.Errorf("StartTime, EndTime = %v, %v", event.StartTime, event.EndTime)
+	}
+	if event.Phase != handlers.PhaseFailure || event.Outcome != handlers.OutcomeFailure {
+		t.Errorf("Phase, Outcome = %q, %q, want failure, failure", event.Phase, event.Outcome)
+	}
+}
+
+func TestStartEvent(t *testing.T) {
+	event := StartEvent("backup", []string{"--full"})
+	if event.Phase != handlers.PhaseStart || event.Outcome != "" || event.Summary() != "started" {
+		t.Errorf("Phase, Outcome, Summary() = %q, %q, %q, want start, empty, started", event.Phase, event.Outcome, event.Summary())
+	}
+	if event.Command != "backup --full" || event.RunID == "" || event.StartTime.IsZero() {
+		t.Errorf("Command, RunID, StartTime = %q, %q, %v, want the command and both set", event.Command, event.RunID, event.StartTime)
+	}
+}
+
+func TestRunWithRetries(t *testing.T) {
+	// The script fails with 3, then 4, then succeeds
+	counter := filepath.Join(t.TempDir(), "count")
+	script := fmt.Sprintf(`n=$(cat %[1]s 2>/dev/null || echo 0); n=$((n+1)); echo $n > %[1]s; echo "attempt $n"; [ $n -ge 3 ] || exit $((n+2))`, counter)
+
+	failhook := NewFailHook(false)
+	failhook.SetPassthrough(nil, nil)
+	failhook.SetCommandRetries(handlers.RetryPolicy{Retries: 1, InitialDelay: 10 * time.Millisecond})
+
+	result, err := failhook.RunWithRetries(context.Background(), "sh", []string{"-c", script})
+	if err == nil || result.ExitCode != 4 {
+		t.Fatalf("ExitCode, err = %d, %v, want 4 after running out of retries", result.ExitCode, err)
+	}
+	event := result.Event("sh", nil)
+	if event.AttemptCount() != 2 || fmt.Sprint(event.AttemptExitCodes()) != "[3 4]" {
+		t.Errorf("attempts = %d %v, want 2 [3 4]", event.AttemptCount(), event.AttemptExitCodes())
+	}
+	if event.Output != "attempt 2" || event.Duration < 10*time.Millisecond {
+		t.Errorf("Output, Duration = %q, %v, want the last attempt and the time of all attempts", event.Output, event.Duration)
+	}
+
+	// The third attempt succeeds
+	result, err = failhook.RunWithRetries(context.Background(), "sh", []string{"-c", script})
+	if err != nil || result.ExitCode != 0 || len(result.Attempts) != 0 {
+		t.Errorf("ExitCode, Attempts, err = %d, %v, %v, want a single successful run", result.ExitCode, result.Attempts, err)
+	}
+}
+
+func TestRunWithRetriesStopsWhenCanceled(t *testing.T) {
+	failhook := NewFailHook(false)
+	failhook.SetPassthrough(nil, nil)
+	failhook.SetCommandRetries(handlers.RetryPolicy{Retries: 5, InitialDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, _ := failhook.RunWithRetries(ctx, "sh", []string{"-c", "exit 1"})
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("RunWithRetries kept waiting after the context was done")
+	}
+	if result.ExitCode != 1 || len(result.Attempts) != 0 {
+		t.Errorf("ExitCode, Attempts = %d, %v, want the only attempt", result.ExitCode, result.Attempts)
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	ignore, _ := handlers.ParseExitCodes("1,3")
+	only, _ := handlers.ParseExitCodes("1-10,124-137")
+
+	failhook := NewFailHook(false)
+	failhook.SetFailureCodes(ignore, nil)
+	for code, want := range map[int]bool{0: false, 1: false, 2: true, 3: false, 200: true} {
+		if got := failhook.IsFailure(code); got != want {
+			t.Errorf("with -ignore-codes 1,3: IsFailure(%d) = %v, want %v", code, got, want)
+		}
+	}
+
+	failhook.SetFailureCodes(ignore, only)
+	for code, want := range map[int]bool{0: false, 1: false, 2: true, 11: false, 130: true} {
+		if got := failhook.IsFailure(code); got != want {
+			t.Errorf("with both sets: IsFailure(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestRunWithRetriesIgnoredCode(t *testing.T) {
+	ignore, _ := handlers.ParseExitCodes("3")
+	failhook := NewFailHook(false)
+	failhook.SetPassthrough(nil, nil)
+	failhook.SetFailureCodes(ignore, nil)
+	failhook.SetCommandRetries(handlers.RetryPolicy{Retries: 2, InitialDelay: time.Hour})
+
+	result, _ := failhook.RunWithRetries(context.Background(), "sh", []string{"-c", "exit 3"})
+	if result.ExitCode != 3 || len(result.Attempts) != 0 {
+		t.Errorf("ExitCode, Attempts = %d, %v, want a single attempt", result.ExitCode, result.Attempts)
+	}
+}
+
+func TestCommandRetryPolicy(t *testing.T) {
+	policy, err := CommandRetryPolicy(3, time.Second, BackoffFixed, time.Minute)
+	if err != nil || policy.Delay(1) != time.Second || policy.Delay(3) != time.Second {
+		t.Errorf("fixed policy = %+v, %v", policy, err)
+	}
+	policy, err = CommandRetryPolicy(5, time.Second, BackoffExponential, 3*time.Second)
+	if err != nil || policy.Delay(2) != 2*time.Second || policy.Delay(4) != 3*time.Second {
+		t.Errorf("exponential policy = %+v, %v", policy, err)
+	}
+	if _, err := CommandRetryPolicy(1, time.Second, "linear", 0); err == nil {
+		t.Error("CommandRetryPolicy accepted an unknown backoff")
+	}
+}
+
+func TestHandleFailureError(t *testing.T) {
+	failhook := NewFailHook(false)
+
+	// A handler writing into a missing directory always fails
+	failing := &testHandler{outputPath: filepath.Join(t.TempDir(), "missing", "output.txt")}
+	working := &testHandler{outputPath: filepath.Join(t.TempDir(), "output.txt")}
+	failhook.AddHandler(failing)
+	failhook.AddHandler(working)
+
+	if err := failhook.HandleFailure(1, "output"); err == nil {
+		t.Error("HandleFailure() error = nil, want error")
+	}
+
+	// The remaining handlers still run after a failure
+	if _, err := os.Stat(working.outputPath); err != nil {
+		t.Errorf("second handler did not run: %v", err)
+	}
+}
+
+func TestFinalExitCode(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+
+	tests := []struct {
+		name       string
+		policy     string
+		exitCode   int
+		handlerErr error
+		want       int
+	}{
+		{"child propagates exit code", ExitPolicyChild, 42, nil, 42},
+		{"child ignores handler errors", ExitPolicyChild, 42, handlerErr, 42},
+		{"child propagates timeout", ExitPolicyChild, 124, nil, 124},
+		{"handler without errors", ExitPolicyHandler, 3, nil, 3},
+		{"handler with errors", ExitPolicyHandler, 3, handlerErr, ExitCodeHandlerError},
+		{"zero", ExitPolicyZero, 42, handlerErr, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FinalExitCode(tt.policy, tt.exitCode, tt.handlerErr); got != tt.want {
+				t.Errorf("FinalExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDebugMode(t *testing.T) {
 	// Redirect stdout to capture debug output
 	oldStdout := os.Stdout
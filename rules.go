@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// ExitCodeOutputFailure is the exit status used by the child exit policy when
+// the command exited 0 but its output broke an output rule
+const ExitCodeOutputFailure = 1
+
+// OutputRules detect failures in the output of commands that do not report
+// them in their exit code. Every rule is checked line by line against both
+// streams.
+type OutputRules struct {
+	// FailOn fails a run with an output line matching any of the patterns
+	FailOn []*regexp.Regexp
+	// FailOnStderr fails a run that wrote anything but whitespace to stderr
+	FailOnStderr bool
+	// SuccessMarkers fails a run unless every pattern matches an output line
+	SuccessMarkers []*regexp.Regexp
+}
+
+// NewOutputRules compiles the patterns of -fail-on-regex and -success-marker
+func NewOutputRules(failOn []string, failOnStderr bool, successMarkers []string) (*OutputRules, error) {
+	rules := &OutputRules{FailOnStderr: failOnStderr}
+	for _, pattern := range failOn {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -fail-on-regex %q: %v", pattern, err)
+		}
+		rules.FailOn = append(rules.FailOn, re)
+	}
+	for _, pattern := range successMarkers {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -success-marker %q: %v", pattern, err)
+		}
+		rules.SuccessMarkers = append(rules.SuccessMarkers, re)
+	}
+	return rules, nil
+}
+
+// Empty reports whether there are no rules to check
+func (r *OutputRules) Empty() bool {
+	return r == nil || len(r.FailOn) == 0 && !r.FailOnStderr && len(r.SuccessMarkers) == 0
+}
+
+// Check checks the output lines of a run. It returns the first line that
+// matched a -fail-on-regex pattern, or for -fail-on-stderr the first stderr
+// line, and a description of the broken rule, which is empty if the output
+// passed.
+func (r *OutputRules) Check(lines []handlers.OutputLine) (match, reason string) {
+	if r.Empty() {
+		return "", ""
+	}
+
+	found := make([]bool, len(r.SuccessMarkers))
+	for _, line := range lines {
+		for i, re := range r.SuccessMarkers {
+			if !found[i] && re.MatchString(line.Text) {
+				found[i] = true
+			}
+		}
+		if reason != "" {
+			continue
+		}
+		for _, re := range r.FailOn {
+			if re.MatchString(line.Text) {
+				match, reason = line.Text, fmt.Sprintf("output matched %q", re.String())
+				break
+			}
+		}
+		if reason == "" && r.FailOnStderr && line.Stream == handlers.StreamStderr && strings.TrimSpace(line.Text) != "" {
+			match, reason = line.Text, "output was written to stderr"
+		}
+	}
+	if reason != "" {
+		return match, reason
+	}
+
+	for i, re := range r.SuccessMarkers {
+		if !found[i] {
+			return "", fmt.Sprintf("success marker %q not found in output", re.String())
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+func outputLines(stream string, texts ...string) []handlers.OutputLine {
+	lines := make([]handlers.OutputLine, len(texts))
+	for i, text := range texts {
+		lines[i] = handlers.OutputLine{Stream: stream, Text: text}
+	}
+	return lines
+}
+
+func TestOutputRulesCheck(t *testing.T) {
+	stdout := outputLines(handlers.StreamStdout, "copying files", "ERROR: disk full", "FATAL: giving up")
+	stderr := outputLines(handlers.StreamStderr, " ", "warning: slow disk")
+
+	tests := []struct {
+		name       string
+		failOn     []string
+		stderr     bool
+		markers    []string
+		lines      []handlers.OutputLine
+		wantMatch  string
+		wantReason string
+	}{
+		{name: "no rules", lines: stdout},
+		{name: "first matching line", failOn: []string{"FATAL", "^ERROR"}, lines: stdout,
+			wantMatch: "ERROR: disk full", wantReason: `output matched "^ERROR"`},
+		{name: "no match", failOn: []string{"panic"}, lines: stdout},
+		{name: "stderr", stderr: true, lines: append(stdout[:1:1], stderr...),
+			wantMatch: "warning: slow disk", wantReason: "output was written to stderr"},
+		{name: "blank stderr", stderr: true, lines: stderr[:1]},
+		{name: "marker found", markers: []string{"^copying", "FATAL"}, lines: stdout},
+		{name: "marker missing", markers: []string{"^Backup complete"}, lines: stdout,
+			wantReason: `success marker "^Backup complete" not found in output`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := NewOutputRules(tt.failOn, tt.stderr, tt.markers)
+			if err != nil {
+				t.Fatalf("NewOutputRules failed: %v", err)
+			}
+			match, reason := rules.Check(tt.lines)
+			if match != tt.wantMatch || reason != tt.wantReason {
+				t.Errorf("Check() = %q, %q, want %q, %q", match, reason, tt.wantMatch, tt.wantReason)
+			}
+		})
+	}
+
+	if _, err := NewOutputRules([]string{"("}, false, nil); err == nil || !strings.Contains(err.Error(), "-fail-on-regex") {
+		t.Errorf("NewOutputRules error = %v, want invalid -fail-on-regex", err)
+	}
+}
+
+func TestFailedOnOutput(t *testing.T) {
+	rules, _ := NewOutputRules([]string{"ERROR"}, false, nil)
+	failhook := NewFailHook(false)
+	failhook.SetPassthrough(nil, nil)
+	failhook.SetOutputRules(rules)
+
+	result, _ := failhook.RunWithRetries(context.Background(), "sh", []string{"-c", "echo 'ERROR: no license'"})
+	event := result.Event("sh", nil)
+	if event.ExitCode != 0 || event.Match != "ERROR: no license" || event.Class() != handlers.ClassOutput {
+		t.Errorf("ExitCode, Match, Class() = %d, %q, %q", event.ExitCode, event.Match, event.Class())
+	}
+
+	// A failing exit code keeps its class; the match is still recorded
+	result, _ = failhook.RunWithRetries(context.Background(), "sh", []string{"-c", "echo 'ERROR: crashed'; exit 2"})
+	event = result.Event("sh", nil)
+	if event.OutputFailure != "" || event.Match != "ERROR: crashed" || event.Class() != handlers.ClassExit {
+		t.Errorf("OutputFailure, Match, Class() = %q, %q, %q", event.OutputFailure, event.Match, event.Class())
+	}
+
+	result, _ = failhook.RunWithRetries(context.Background(), "sh", []string{"-c", "echo fine"})
+	if failhook.Failed(result) {
+		t.Error("Failed() = true for clean output")
+	}
+}
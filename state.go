@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+// JobState is what failhook remembers about a job between runs
+type JobState struct {
+	// LastOutcome is handlers.OutcomeSuccess or handlers.OutcomeFailure
+	LastOutcome string    `json:"last_outcome"`
+	LastRun     time.Time `json:"last_run"`
+	// ConsecutiveFailures counts the failed runs in a row up to the last run
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// FailingSince is when the first of the consecutive failures started
+	FailingSince time.Time `json:"failing_since"`
+}
+
+// DefaultJobName names a job after its command line, e.g. "backup-1a2b3c4d"
+// for "/usr/local/bin/backup --full", so that jobs running the same program
+// with other arguments keep apart
+func DefaultJobName(command string, args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{command}, args...), "\x00")))
+	return fmt.Sprintf("%s-%s", filepath.Base(command), hex.EncodeToString(sum[:4]))
+}
+
+// JobFileName turns a job name into a file name by replacing characters
+// other than letters, digits, '.', '_' and '-'
+func JobFileName(job string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, job)
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// StateFile returns the file keeping the state of job in dir
+func StateFile(dir, job string) string {
+	return filepath.Join(dir, JobFileName(job)+".json")
+}
+
+// UpdateState records a run of job that started at start and ended with
+// outcome in the state directory dir. It returns the state the job had
+// before the run and the state after it; a job without a state file starts
+// out successful. The file is locked while it is updated, so that
+// overlapping runs of the job count every run once.
+func UpdateState(dir, job, outcome string, start time.Time) (previous, current JobState, err error) {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return previous, current, err
+	}
+	file, err := os.OpenFile(StateFile(dir, job), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return previous, current, err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return previous, current, err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return previous, current, err
+	}
+	// A corrupt state file is treated like a missing one
+	if len(data) == 0 || json.Unmarshal(data, &previous) != nil || previous.LastOutcome == "" {
+		previous = JobState{LastOutcome: handlers.OutcomeSuccess}
+	}
+
+	current = JobState{LastOutcome: outcome, LastRun: start}
+	if outcome == handlers.OutcomeFailure {
+		current.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		current.FailingSince = previous.FailingSince
+		if current.ConsecutiveFailures == 1 || current.FailingSince.IsZero() {
+			current.FailingSince = start
+		}
+	}
+
+	data, err = json.Marshal(current)
+	if err != nil {
+		return previous, current, err
+	}
+	if err := file.Truncate(0); err != nil {
+		return previous, current, err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return previous, current, err
+	}
+	return previous, current, nil
+}
+
+// ApplyState sets the state fields of an event that ended a run of job,
+// given the job's state before and after the run. A run that recovers
+// reports the failures that just ended.
+func ApplyState(event *handlers.FailureEvent, job string, previous, current JobState) {
+	event.Job = job
+	event.PreviousOutcome = previous.LastOutcome
+	event.ConsecutiveFailures = current.ConsecutiveFailures
+	event.FailingSince = current.FailingSince
+	if current.LastOutcome == handlers.OutcomeSuccess && previous.LastOutcome == handlers.OutcomeFailure {
+		event.ConsecutiveFailures = previous.ConsecutiveFailures
+		event.FailingSince = previous.FailingSince
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zishida/failhook/handlers"
+)
+
+func TestUpdateState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	start := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	runs := []struct {
+		outcome      string
+		wantPrevious string
+		wantFailures int
+		wantSince    time.Time
+	}{
+		{handlers.OutcomeSuccess, handlers.OutcomeSuccess, 0, time.Time{}},
+		{handlers.OutcomeFailure, handlers.OutcomeSuccess, 1, start.Add(time.Hour)},
+		{handlers.OutcomeFailure, handlers.OutcomeFailure, 2, start.Add(time.Hour)},
+		{handlers.OutcomeSuccess, handlers.OutcomeFailure, 0, time.Time{}},
+		{handlers.OutcomeFailure, handlers.OutcomeSuccess, 1, start.Add(4 * time.Hour)},
+	}
+
+	for i, run := range runs {
+		previous, current, err := UpdateState(dir, "nightly backup", run.outcome, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("run %d: UpdateState failed: %v", i, err)
+		}
+		if previous.LastOutcome != run.wantPrevious {
+			t.Errorf("run %d: previous outcome = %q, want %q", i, previous.LastOutcome, run.wantPrevious)
+		}
+		if current.ConsecutiveFailures != run.wantFailures || !current.FailingSince.Equal(run.wantSince) {
+			t.Errorf("run %d: failures, failing since = %d, %v, want %d, %v", i, current.ConsecutiveFailures, current.FailingSince, run.wantFailures, run.wantSince)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "nightly_backup.json")); err != nil {
+		t.Errorf("state file not written: %v", err)
+	}
+
+	// Jobs keep separate state
+	previous, _, err := UpdateState(dir, "other", handlers.OutcomeFailure, start)
+	if err != nil || previous.LastOutcome != handlers.OutcomeSuccess {
+		t.Errorf("previous outcome of a new job = %q, %v, want success", previous.LastOutcome, err)
+	}
+}
+
+func TestUpdateStateCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(StateFile(dir, "job"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	previous, current, err := UpdateState(dir, "job", handlers.OutcomeFailure, time.Now())
+	if err != nil || previous.LastOutcome != handlers.OutcomeSuccess || current.ConsecutiveFailures != 1 {
+		t.Errorf("previous, failures, err = %q, %d, %v, want a fresh state", previous.LastOutcome, current.ConsecutiveFailures, err)
+	}
+}
+
+func TestApplyState(t *testing.T) {
+	since := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	failing := JobState{LastOutcome: handlers.OutcomeFailure, ConsecutiveFailures: 3, FailingSince: since}
+
+	// A recovery reports the failures that ended
+	event := handlers.NewFailureEvent(0, "")
+	event.Outcome = handlers.OutcomeSuccess
+	ApplyState(event, "backup", failing, JobState{LastOutcome: handlers.OutcomeSuccess})
+	if !event.Changed() || event.ConsecutiveFailures != 3 || !event.FailingSince.Equal(since) {
+		t.Errorf("Changed(), failures, failing since = %v, %d, %v, want true, 3, %v", event.Changed(), event.ConsecutiveFailures, event.FailingSince, since)
+	}
+
+	// Another failure is not a change
+	event = handlers.NewFailureEvent(1, "")
+	ApplyState(event, "backup", failing, JobState{LastOutcome: handlers.OutcomeFailure, ConsecutiveFailures: 4, FailingSince: since})
+	if event.Changed() || event.ConsecutiveFailures != 4 || event.Job != "backup" {
+		t.Errorf("Changed(), failures, job = %v, %d, %q, want false, 4, backup", event.Changed(), event.ConsecutiveFailures, event.Job)
+	}
+}
+
+func TestDefaultJobName(t *testing.T) {
+	full := DefaultJobName("/usr/local/bin/backup", []string{"--full"})
+	if !strings.HasPrefix(full, "backup-") {
+		t.Errorf("DefaultJobName() = %q, want it to start with the program name", full)
+	}
+	if full == DefaultJobName("/usr/local/bin/backup", []string{"--incremental"}) {
+		t.Error("jobs with different arguments got the same name")
+	}
+	if full != DefaultJobName("/usr/local/bin/backup", []string{"--full"}) {
+		t.Error("DefaultJobName() is not stable")
+	}
+}
+
+func TestJobFileName(t *testing.T) {
+	tests := map[string]string{
+		"backup-1a2b":      "backup-1a2b",
+		"db/dump nightly":  "db_dump_nightly",
+		"../../etc/passwd": ".._.._etc_passwd",
+		"..":               "_..",
+	}
+	for job, want := range tests {
+		if got := JobFileName(job); got != want {
+			t.Errorf("JobFileName(%q) = %q, want %q", job, got, want)
+		}
+	}
+}